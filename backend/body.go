@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoType "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// bodyChunkSize keeps each compressed chunk well below DynamoDB's 400KB item size limit
+const bodyChunkSize = 300 * 1024
+
+// errBodyCorrupted is returned when the stored chunks don't match the manifest on the POST item
+var errBodyCorrupted = errors.New("post body chunks don't match their manifest")
+
+// UpdatePostBody replaces the MDX body of an existing post, refreshing the stats derived from it, and returns the post
+func (r *BlogRepository) UpdatePostBody(ctx context.Context, slug, body string) (*Post, error) {
+	existing, err := r.getPostItem(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, &NotFoundError{Resource: "post", Key: slug}
+	}
+	existing.Body = body
+	if _, err := r.upsertPostItems(ctx, *existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// putBodyChunks compresses the body and writes it as chunks versioned by the body hash,
+// so readers keep seeing the previous version until the manifest on the POST item is switched
+func (r *BlogRepository) putBodyChunks(ctx context.Context, slug, body string) (string, int, error) {
+	sum := sha256.Sum256([]byte(body))
+	bodyHash := hex.EncodeToString(sum[:])
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write([]byte(body)); err != nil {
+		return "", 0, err
+	}
+	if err := writer.Close(); err != nil {
+		return "", 0, err
+	}
+
+	data := compressed.Bytes()
+	chunks := 0
+	for start := 0; start < len(data); start += bodyChunkSize {
+		end := min(start+bodyChunkSize, len(data))
+		_, err := r.Db.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(r.tableName),
+			Item: map[string]dynamoType.AttributeValue{
+				"PK":   &dynamoType.AttributeValueMemberS{Value: bodyPartitionKey(slug)},
+				"SK":   &dynamoType.AttributeValueMemberS{Value: bodyChunkSortKey(bodyHash, chunks)},
+				"data": &dynamoType.AttributeValueMemberB{Value: data[start:end]},
+				"Type": &dynamoType.AttributeValueMemberS{Value: "BODY_CHUNK"},
+			},
+		})
+		if err != nil {
+			return "", 0, err
+		}
+		chunks++
+	}
+	return bodyHash, chunks, nil
+}
+
+// getPostBody reassembles the body referenced by the manifest of a POST item
+func (r *BlogRepository) getPostBody(ctx context.Context, post Post) (string, error) {
+	if post.BodyHash == "" {
+		return "", nil
+	}
+	paginator := dynamodb.NewQueryPaginator(r.Db, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]dynamoType.AttributeValue{
+			":pk":        &dynamoType.AttributeValueMemberS{Value: bodyPartitionKey(post.Slug)},
+			":sk_prefix": &dynamoType.AttributeValueMemberS{Value: bodyVersionPrefix(post.BodyHash)},
+		},
+		ScanIndexForward: aws.Bool(true),
+	})
+	var compressed bytes.Buffer
+	chunks := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, item := range page.Items {
+			data, ok := item["data"].(*dynamoType.AttributeValueMemberB)
+			if !ok {
+				return "", errBodyCorrupted
+			}
+			compressed.Write(data.Value)
+			chunks++
+		}
+	}
+	if chunks != post.BodyChunks {
+		return "", errBodyCorrupted
+	}
+
+	reader, err := gzip.NewReader(&compressed)
+	if err != nil {
+		return "", err
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != post.BodyHash {
+		return "", errBodyCorrupted
+	}
+	return string(body), nil
+}
+
+// pruneBodyChunks deletes every chunk of a post that doesn't belong to the kept version,
+// an empty keepHash deletes them all
+func (r *BlogRepository) pruneBodyChunks(ctx context.Context, slug, keepHash string) error {
+	tableName := r.tableName
+	paginator := dynamodb.NewQueryPaginator(r.Db, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]dynamoType.AttributeValue{
+			":pk": &dynamoType.AttributeValueMemberS{Value: bodyPartitionKey(slug)},
+		},
+		ProjectionExpression: aws.String("PK, SK"),
+	})
+	var deleteRequests []dynamoType.WriteRequest
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, key := range page.Items {
+			sk := key["SK"].(*dynamoType.AttributeValueMemberS).Value
+			if keepHash != "" && strings.HasPrefix(sk, bodyVersionPrefix(keepHash)) {
+				continue
+			}
+			deleteRequests = append(deleteRequests, dynamoType.WriteRequest{
+				DeleteRequest: &dynamoType.DeleteRequest{Key: key},
+			})
+		}
+	}
+	return r.batchWrite(ctx, deleteRequests)
+}
+
+func bodyPartitionKey(slug string) string {
+	return fmt.Sprintf("BODY#%s", slug)
+}
+
+func bodyVersionPrefix(bodyHash string) string {
+	return fmt.Sprintf("VERSION#%s#", bodyHash)
+}
+
+func bodyChunkSortKey(bodyHash string, chunk int) string {
+	return fmt.Sprintf("%sCHUNK#%05d", bodyVersionPrefix(bodyHash), chunk)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPostBodyChunks(t *testing.T) {
+	ctx := context.Background()
+	fake, repository := newFakeDynamo(t)
+	// random text barely compresses, so the body spans several chunks
+	random := make([]byte, 3*bodyChunkSize)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	large := testPost("large", "2024-01-01", "go")
+	large.Body = base64.StdEncoding.EncodeToString(random)
+	if _, err := repository.UpsertPost(ctx, large); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	chunks := fake.partition(bodyPartitionKey("large"))
+	if len(chunks) < 3 {
+		t.Fatalf("expected the body to span several chunks, got %v", chunks)
+	}
+	post, err := repository.GetPost(ctx, "large")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if post.Body != large.Body {
+		t.Errorf("expected the body to round trip, got %d bytes instead of %d", len(post.Body), len(large.Body))
+	}
+
+	// a new version replaces the chunks of the previous one once the manifest points to it
+	if _, err := repository.UpdatePostBody(ctx, "large", "# Small\n\nnow"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	post, err = repository.GetPost(ctx, "large")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if post.Body != "# Small\n\nnow" || len(post.Toc) != 1 {
+		t.Errorf("unexpected post after the body update %+v", post)
+	}
+	chunks = fake.partition(bodyPartitionKey("large"))
+	if len(chunks) != 1 || !strings.HasPrefix(chunks[0], bodyVersionPrefix(post.BodyHash)) {
+		t.Errorf("expected only the chunk of the new version to be kept, got %v", chunks)
+	}
+
+	if _, err := repository.DeletePost(ctx, "large"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if chunks := fake.partition(bodyPartitionKey("large")); len(chunks) != 0 {
+		t.Errorf("expected the chunks to be deleted with the post, got %v", chunks)
+	}
+}
+
+func TestContentUpdatedEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	_, repository := newFakeDynamo(t)
+	if _, err := repository.UpsertPost(ctx, testPost("hello", "2024-01-01", "go")); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	controller := &BlogController{repository: repository, surrogateKeys: NewSurrogateKeyIndex(repository)}
+	router := gin.New()
+	router.Use(ProblemMiddleware())
+	router.POST("/events", controller.PostsUpdatedGcpSubscriptionHandler)
+	send := func(slug, data string) int {
+		event := map[string]any{"subscription": "posts", "message": map[string]any{
+			"data": data, "message_id": "1", "publish_time": "2024-01-01T00:00:00Z",
+			"attributes": map[string]string{"eventType": "CONTENT_UPDATED", "slug": slug},
+		}}
+		payload, _ := json.Marshal(event)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/events", strings.NewReader(string(payload))))
+		return recorder.Code
+	}
+	encode := func(post map[string]string) string {
+		marshaled, _ := json.Marshal(post)
+		return base64.StdEncoding.EncodeToString(marshaled)
+	}
+
+	cases := map[string]struct {
+		slug, data string
+		status     int
+	}{
+		"updated":      {slug: "hello", data: encode(map[string]string{"body": "# Hello\n\nworld"}), status: 200},
+		"missing post": {slug: "missing", data: encode(map[string]string{"body": "# Hello"}), status: 404},
+		"not base64":   {slug: "hello", data: encode(map[string]string{"body": "# Hello"}) + "!", status: 400},
+		"not json":     {slug: "hello", data: base64.StdEncoding.EncodeToString([]byte("{")), status: 400},
+	}
+	for name, tc := range cases {
+		if status := send(tc.slug, tc.data); status != tc.status {
+			t.Errorf("%s: expected status %d, got %d", name, tc.status, status)
+		}
+	}
+	post, err := repository.GetPost(ctx, "hello")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if post.Body != "# Hello\n\nworld" || post.WordCount == 0 {
+		t.Errorf("expected the body and its stats to be updated, got %+v", post)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CachePolicy describes how clients and the CDN may cache the successful responses of a route,
+// durations are in seconds. Non 2xx responses are never cached
+type CachePolicy struct {
+	NoStore              bool     `json:"noStore,omitempty"`
+	MaxAge               int      `json:"maxAge,omitempty"`  // browsers
+	SMaxAge              int      `json:"sMaxAge,omitempty"` // the CDN, which is invalidated on writes
+	StaleWhileRevalidate int      `json:"staleWhileRevalidate,omitempty"`
+	StaleIfError         int      `json:"staleIfError,omitempty"`
+	Vary                 []string `json:"vary,omitempty"`
+}
+
+// CacheControl renders the policy as a Cache-Control header value
+func (p CachePolicy) CacheControl() string {
+	if p.NoStore {
+		return "no-store"
+	}
+	directives := []string{"public", "max-age=" + strconv.Itoa(p.MaxAge)}
+	if p.SMaxAge > 0 {
+		directives = append(directives, "s-maxage="+strconv.Itoa(p.SMaxAge))
+	}
+	if p.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+strconv.Itoa(p.StaleWhileRevalidate))
+	}
+	if p.StaleIfError > 0 {
+		directives = append(directives, "stale-if-error="+strconv.Itoa(p.StaleIfError))
+	}
+	return strings.Join(directives, ", ")
+}
+
+// CdnTTL is how long the CDN may serve a response, stale allowances included
+func (p CachePolicy) CdnTTL() time.Duration {
+	if p.NoStore || p.SMaxAge <= 0 {
+		return 0
+	}
+	return time.Duration(p.SMaxAge+max(p.StaleWhileRevalidate, p.StaleIfError)) * time.Second
+}
+
+const (
+	// defaultCachePolicy applies to GET routes that don't name a policy
+	defaultCachePolicy = "default"
+	noStoreCachePolicy = "no-store"
+)
+
+// defaultCachePolicies are the built-in policies, CACHE_POLICIES overrides or adds to them
+var defaultCachePolicies = map[string]CachePolicy{
+	defaultCachePolicy: {MaxAge: 360, SMaxAge: 31536000, StaleWhileRevalidate: 60, StaleIfError: 86400, Vary: []string{"Accept-Encoding"}},
+	"feed":             {MaxAge: 3600, SMaxAge: 31536000, StaleWhileRevalidate: 3600, StaleIfError: 86400, Vary: []string{"Accept-Encoding"}},
+	"docs":             {MaxAge: 3600, SMaxAge: 86400, StaleWhileRevalidate: 86400, Vary: []string{"Accept-Encoding"}},
+	noStoreCachePolicy: {NoStore: true},
+}
+
+// CachePolicies resolves the cache policy of each route, keyed by route path
+type CachePolicies struct {
+	policies map[string]CachePolicy
+	routes   map[string]string // route path -> policy name
+}
+
+// NewCachePolicies builds the registry from the policies named in the route table, then applies
+// CACHE_POLICIES, a JSON object of policies by name e.g. {"default":{"maxAge":60,"sMaxAge":86400}},
+// and ROUTE_CACHE_POLICIES, a comma separated list of route=policy pairs e.g. "/blog/tags=docs"
+func NewCachePolicies(routes []Route) *CachePolicies {
+	registry := &CachePolicies{policies: map[string]CachePolicy{}, routes: map[string]string{}}
+	for name, policy := range defaultCachePolicies {
+		registry.policies[name] = policy
+	}
+	if config := os.Getenv("CACHE_POLICIES"); config != "" {
+		var policies map[string]CachePolicy
+		if err := json.Unmarshal([]byte(config), &policies); err != nil {
+			slog.Warn("Ignoring invalid CACHE_POLICIES", "Error", err)
+		}
+		for name, policy := range policies {
+			registry.policies[name] = policy
+		}
+	}
+	for _, route := range routes {
+		if route.CachePolicy != "" {
+			registry.routes[route.Path] = route.CachePolicy
+		}
+	}
+	if config := os.Getenv("ROUTE_CACHE_POLICIES"); config != "" {
+		for _, entry := range strings.Split(config, ",") {
+			route, name, found := strings.Cut(strings.TrimSpace(entry), "=")
+			if _, ok := registry.policies[name]; !found || !ok {
+				slog.Warn("Ignoring invalid ROUTE_CACHE_POLICIES entry", "Entry", entry)
+				continue
+			}
+			registry.routes[route] = name
+		}
+	}
+	for route, name := range registry.routes {
+		if _, ok := registry.policies[name]; !ok {
+			slog.Warn("Route names an unknown cache policy, using the default", "Route", route, "Policy", name)
+			registry.routes[route] = defaultCachePolicy
+		}
+	}
+	return registry
+}
+
+// For returns the policy of a route, only GET and HEAD responses are cacheable.
+// Policies configured for legacy paths also apply to the current version
+func (cp *CachePolicies) For(method, route string) CachePolicy {
+	if method != http.MethodGet && method != http.MethodHead {
+		return cp.policies[noStoreCachePolicy]
+	}
+	name, ok := cp.routes[route]
+	if !ok {
+		name, ok = cp.routes[unversionedRoute(route)]
+	}
+	if !ok {
+		name = defaultCachePolicy
+	}
+	return cp.policies[name]
+}
+
+// Middleware applies the policy of the matched route once the response status is known,
+// so errors rendered by ProblemMiddleware are marked no-store. It must run before ProblemMiddleware
+func (cp *CachePolicies) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &cacheWriter{ResponseWriter: c.Writer, policy: cp.For(c.Request.Method, c.FullPath())}
+		c.Next()
+	}
+}
+
+// cacheWriter sets the caching headers right before the status is written, a Cache-Control set by
+// the handler itself is kept on successful responses e.g. GraphQL errors answered with 200
+type cacheWriter struct {
+	gin.ResponseWriter
+	policy CachePolicy
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	w.applyPolicy(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheWriter) WriteHeaderNow() {
+	w.applyPolicy(w.Status())
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	w.applyPolicy(w.Status())
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	w.applyPolicy(w.Status())
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *cacheWriter) applyPolicy(status int) {
+	if w.Written() {
+		return
+	}
+	header := w.Header()
+	if status < 200 || (status >= 300 && status != http.StatusNotModified) {
+		header.Set("Cache-Control", "no-store")
+		return
+	}
+	if header.Get("Cache-Control") == "" {
+		header.Set("Cache-Control", w.policy.CacheControl())
+	}
+	for _, name := range w.policy.Vary {
+		if !slices.ContainsFunc(header.Values("Vary"), func(value string) bool { return varies(value, name) }) {
+			header.Add("Vary", name)
+		}
+	}
+}
+
+// varies tells whether a Vary header value already lists a header name
+func varies(value, name string) bool {
+	for _, listed := range strings.Split(value, ",") {
+		if listed = strings.TrimSpace(listed); listed == "*" || strings.EqualFold(listed, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCachePolicyByStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	routes := []Route{{Method: "GET", Path: "/blog/v1/tags", CachePolicy: "docs"}}
+	router := gin.New()
+	router.Use(NewCachePolicies(routes).Middleware(), ProblemMiddleware())
+	fail := false
+	router.GET("/blog/v1/tags", func(c *gin.Context) {
+		if fail {
+			abortWithError(c, errors.New("boom"))
+			return
+		}
+		c.Header("Vary", "accept-encoding")
+		c.JSON(200, []TagWithCount{})
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/blog/v1/tags", nil))
+	if got := recorder.Header().Get("Cache-Control"); got != defaultCachePolicies["docs"].CacheControl() {
+		t.Errorf("unexpected Cache-Control %q", got)
+	}
+	if got := recorder.Header().Values("Vary"); len(got) != 1 {
+		t.Errorf("expected Vary to list Accept-Encoding once, got %q", got)
+	}
+
+	fail = true
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/blog/v1/tags", nil))
+	if recorder.Code != 500 || recorder.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("errors should never be cached, got %d with %q", recorder.Code, recorder.Header().Get("Cache-Control"))
+	}
+}
+
+func TestCachePoliciesFromEnv(t *testing.T) {
+	t.Setenv("CACHE_POLICIES", `{"short":{"maxAge":10,"staleIfError":60}}`)
+	t.Setenv("ROUTE_CACHE_POLICIES", "/blog/tags=short,/blog/posts=unknown")
+	policies := NewCachePolicies(nil)
+	if got := policies.For("GET", "/blog/v1/tags").CacheControl(); got != "public, max-age=10, stale-if-error=60" {
+		t.Errorf("expected the legacy route policy to apply to v1, got %q", got)
+	}
+	if got := policies.For("GET", "/blog/v1/posts").CacheControl(); got != defaultCachePolicies[defaultCachePolicy].CacheControl() {
+		t.Errorf("expected unknown policies to be ignored, got %q", got)
+	}
+	if got := policies.For("PUT", "/blog/v1/tags").CacheControl(); got != "no-store" {
+		t.Errorf("expected writes to be no-store, got %q", got)
+	}
+}
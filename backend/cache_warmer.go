@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultWarmConcurrency = 4
+	defaultWarmTopTags     = 5
+	// warmCheckDelay is how long a warm message waits in the queue before the invalidation is first checked,
+	// CloudFront usually completes one within a minute. Incomplete invalidations are retried after the queue's
+	// visibility timeout
+	warmCheckDelay = time.Minute
+	// maxInvalidationWait bounds the wait for CloudFront to complete an invalidation, warming is skipped past it
+	maxInvalidationWait = 10 * time.Minute
+	warmRequestTimeout  = 30 * time.Second
+)
+
+// defaultWarmPaths are the first pages as the frontend requests them, since the CDN caches by exact query string.
+// {tag} is expanded to the most used tags and {slug} to the posts a write changed
+var defaultWarmPaths = []string{
+	legacyPrefix + "/posts?limit=6",
+	legacyPrefix + "/posts?limit=4",
+	legacyPrefix + "/tags",
+	legacyPrefix + "/posts?tag={tag}&limit=6",
+	apiPrefix + "/posts/{slug}",
+}
+
+// CacheWarmer requests the most visited paths through the CDN once an invalidation completes,
+// so the first visitors after a write don't pay for a cold origin. Writes enqueue a message that the function
+// receives back as an event once the invalidation had time to complete, so no work outlives the request
+// that triggered it. A nil warmer does nothing
+type CacheWarmer struct {
+	baseURL     string
+	queueURL    string
+	paths       []string
+	topTags     int
+	concurrency int
+	client      *http.Client
+	repository  *BlogRepository
+	now         func() time.Time
+}
+
+// NewCacheWarmerFromEnv reads CACHE_WARM_BASE_URL, the CDN origin paths are requested against e.g.
+// "https://api.example.com", and CACHE_WARM_QUEUE_URL, the SQS queue delivering warm messages back to the
+// function, warming is disabled without them. CACHE_WARM_PATHS is a comma separated list of paths,
+// CACHE_WARM_TOP_TAGS the number of tags {tag} expands to and CACHE_WARM_CONCURRENCY the requests in flight
+func NewCacheWarmerFromEnv(repository *BlogRepository) *CacheWarmer {
+	baseURL := strings.TrimSuffix(os.Getenv("CACHE_WARM_BASE_URL"), "/")
+	queueURL := os.Getenv("CACHE_WARM_QUEUE_URL")
+	if baseURL == "" {
+		return nil
+	}
+	if queueURL == "" {
+		slog.Warn("CACHE_WARM_QUEUE_URL isn't set, cache warming is disabled")
+		return nil
+	}
+	warmer := &CacheWarmer{
+		baseURL:    baseURL,
+		queueURL:   queueURL,
+		paths:      defaultWarmPaths,
+		client:     &http.Client{Timeout: warmRequestTimeout},
+		repository: repository,
+		now:        time.Now,
+	}
+	if value := os.Getenv("CACHE_WARM_PATHS"); value != "" {
+		warmer.paths = nil
+		for _, path := range strings.Split(value, ",") {
+			if path = strings.TrimSpace(path); strings.HasPrefix(path, "/") {
+				warmer.paths = append(warmer.paths, path)
+			} else if path != "" {
+				slog.Warn("Ignoring invalid CACHE_WARM_PATHS entry", "Entry", path)
+			}
+		}
+	}
+	warmer.topTags = envInt("CACHE_WARM_TOP_TAGS", defaultWarmTopTags, 0)
+	warmer.concurrency = envInt("CACHE_WARM_CONCURRENCY", defaultWarmConcurrency, 1)
+	return warmer
+}
+
+// warmMessage is the body of the messages of the warm queue
+type warmMessage struct {
+	InvalidationID string    `json:"invalidation_id"`
+	Slugs          []string  `json:"slugs,omitempty"`
+	RequestedAt    time.Time `json:"requested_at"`
+}
+
+// AfterInvalidation enqueues the warming of the cache once the invalidation completes, failures are logged
+// as a cold cache only costs the next visitors some latency
+func (cw *CacheWarmer) AfterInvalidation(ctx context.Context, invalidationID string, slugs ...string) {
+	if cw == nil || invalidationID == "" {
+		return
+	}
+	body, err := json.Marshal(warmMessage{InvalidationID: invalidationID, Slugs: slugs, RequestedAt: cw.now()})
+	if err == nil {
+		err = cw.repository.EnqueueMessage(ctx, cw.queueURL, string(body), warmCheckDelay)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to enqueue cache warming", "InvalidationID", invalidationID, "Error", err)
+	}
+}
+
+// HandleMessages warms the cache for the messages whose invalidation completed, it returns the IDs of the
+// messages to retry, those whose invalidation is still in progress or couldn't be checked
+func (cw *CacheWarmer) HandleMessages(ctx context.Context, records []QueueRecord) []string {
+	var retry []string
+	for _, record := range records {
+		var message warmMessage
+		if err := json.Unmarshal([]byte(record.Body), &message); err != nil || message.InvalidationID == "" {
+			slog.ErrorContext(ctx, "Dropping malformed cache warming message", "MessageID", record.MessageID, "Error", err)
+			continue
+		}
+		completed, err := cw.repository.InvalidationCompleted(ctx, message.InvalidationID)
+		switch {
+		case err != nil:
+			slog.ErrorContext(ctx, "Failed to check the invalidation", "InvalidationID", message.InvalidationID, "Error", err)
+			retry = append(retry, record.MessageID)
+		case completed:
+			cw.Warm(ctx, message.Slugs...)
+		case cw.now().Sub(message.RequestedAt) > maxInvalidationWait:
+			slog.WarnContext(ctx, "Invalidation still in progress, skipping cache warming", "InvalidationID", message.InvalidationID)
+		default:
+			retry = append(retry, record.MessageID)
+		}
+	}
+	return retry
+}
+
+// CacheWarmEventHandler receives the warm queue's messages, the Lambda adapter posts SQS events to
+// AWS_LWA_PASS_THROUGH_PATH. Messages to retry are reported as batch item failures
+func (bc *BlogController) CacheWarmEventHandler(c *gin.Context) {
+	var event QueueEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		abortWithError(c, NewBindingError(err))
+		return
+	}
+	response := QueueEventResponse{BatchItemFailures: []BatchItemFailure{}}
+	if bc.warmer != nil {
+		for _, id := range bc.warmer.HandleMessages(c.Request.Context(), event.Records) {
+			response.BatchItemFailures = append(response.BatchItemFailures, BatchItemFailure{ItemIdentifier: id})
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Warm requests the warm paths, expanded for the most used tags and the given slugs
+func (cw *CacheWarmer) Warm(ctx context.Context, slugs ...string) {
+	var tags []TagWithCount
+	if cw.topTags > 0 {
+		all, err := cw.repository.GetTags(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get the tags to warm, skipping tag listings", "Error", err)
+		} else {
+			tags = (*all)[:min(cw.topTags, len(*all))]
+		}
+	}
+	paths := warmPaths(cw.paths, tags, slugs)
+	cw.fetch(ctx, paths)
+	slog.InfoContext(ctx, "Cache warmed", "Paths", len(paths))
+}
+
+// warmPaths expands the {tag} and {slug} placeholders, paths with a placeholder and nothing to expand it to are skipped
+func warmPaths(templates []string, tags []TagWithCount, slugs []string) []string {
+	var paths []string
+	for _, template := range templates {
+		switch {
+		case strings.Contains(template, "{tag}"):
+			for _, tag := range tags {
+				paths = append(paths, strings.ReplaceAll(template, "{tag}", url.QueryEscape(tag.Tag)))
+			}
+		case strings.Contains(template, "{slug}"):
+			for _, slug := range slugs {
+				paths = append(paths, strings.ReplaceAll(template, "{slug}", url.PathEscape(slug)))
+			}
+		default:
+			paths = append(paths, template)
+		}
+	}
+	return paths
+}
+
+func postSlugs(posts []Post) []string {
+	slugs := make([]string, 0, len(posts))
+	for _, post := range posts {
+		slugs = append(slugs, post.Slug)
+	}
+	return slugs
+}
+
+// fetch requests the paths with at most concurrency requests in flight, failures are logged
+func (cw *CacheWarmer) fetch(ctx context.Context, paths []string) {
+	var group errgroup.Group
+	group.SetLimit(cw.concurrency)
+	for _, path := range paths {
+		group.Go(func() error {
+			request, err := http.NewRequestWithContext(ctx, http.MethodGet, cw.baseURL+path, nil)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to build the cache warming request", "Path", path, "Error", err)
+				return nil
+			}
+			// the CDN caches encodings apart, warm the one browsers negotiate
+			request.Header.Set("Accept-Encoding", "br, gzip")
+			response, err := cw.client.Do(request)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to warm the cache", "Path", path, "Error", err)
+				return nil
+			}
+			defer response.Body.Close()
+			_, _ = io.Copy(io.Discard, response.Body)
+			if response.StatusCode != http.StatusOK {
+				slog.WarnContext(ctx, "Unexpected status warming the cache", "Path", path, "Status", response.StatusCode)
+			}
+			return nil
+		})
+	}
+	_ = group.Wait()
+}
+
+// InvalidationCompleted tells whether CloudFront completed an invalidation
+func (r *BlogRepository) InvalidationCompleted(ctx context.Context, invalidationID string) (bool, error) {
+	output, err := r.cdn.GetInvalidation(ctx, &cloudfront.GetInvalidationInput{
+		DistributionId: aws.String(r.cloudfrontDistroId),
+		Id:             aws.String(invalidationID),
+	})
+	if err != nil {
+		return false, err
+	}
+	return aws.ToString(output.Invalidation.Status) == "Completed", nil
+}
+
+// EnqueueMessage sends a message to an SQS queue, delivered once delay elapsed
+func (r *BlogRepository) EnqueueMessage(ctx context.Context, queueURL string, body string, delay time.Duration) error {
+	_, err := r.queue.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:     aws.String(queueURL),
+		MessageBody:  aws.String(body),
+		DelaySeconds: int32(delay.Seconds()),
+	})
+	return err
+}
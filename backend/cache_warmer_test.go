@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+)
+
+func TestWarmPaths(t *testing.T) {
+	tags := []TagWithCount{{Tag: "go", Count: 3}, {Tag: "c++", Count: 1}}
+	got := warmPaths(defaultWarmPaths, tags, []string{"hello-world"})
+	want := []string{
+		"/blog/posts?limit=6",
+		"/blog/posts?limit=4",
+		"/blog/tags",
+		"/blog/posts?tag=go&limit=6",
+		"/blog/posts?tag=c%2B%2B&limit=6",
+		"/blog/v1/posts/hello-world",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected paths %q", got)
+	}
+	if got := warmPaths(defaultWarmPaths, nil, nil); len(got) != 3 {
+		t.Errorf("placeholders without values should be skipped, got %q", got)
+	}
+}
+
+func TestCacheWarmerConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			previous := peak.Load()
+			if current <= previous || peak.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		mu.Lock()
+		requested = append(requested, r.URL.RequestURI())
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	warmer := &CacheWarmer{baseURL: server.URL, concurrency: 2, client: server.Client()}
+	paths := warmPaths(defaultWarmPaths, nil, []string{"a", "b", "c", "d"})
+	warmer.fetch(context.Background(), paths)
+	if len(requested) != len(paths) {
+		t.Errorf("expected %d requests, got %q", len(paths), requested)
+	}
+	if peak.Load() > 2 {
+		t.Errorf("expected at most 2 requests in flight, got %d", peak.Load())
+	}
+}
+
+func TestCacheWarmerRetriesIncompleteInvalidations(t *testing.T) {
+	statuses := map[string]string{"done": "Completed", "pending": "InProgress", "stale": "InProgress"}
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		status, ok := statuses[id]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, "<Invalidation><Id>%s</Id><Status>%s</Status></Invalidation>", id, status)
+	}))
+	defer cdn.Close()
+	var warmed atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { warmed.Add(1) }))
+	defer origin.Close()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	repository := &BlogRepository{cloudfrontDistroId: "E123", cdn: cloudfront.New(cloudfront.Options{
+		Region: "us-east-1", BaseEndpoint: aws.String(cdn.URL), Credentials: aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})}
+	warmer := &CacheWarmer{baseURL: origin.URL, paths: []string{"/blog/tags"}, concurrency: 1,
+		client: origin.Client(), repository: repository, now: func() time.Time { return now }}
+	message := func(id string, age time.Duration) string {
+		return fmt.Sprintf(`{"invalidation_id":%q,"requested_at":%q}`, id, now.Add(-age).Format(time.RFC3339))
+	}
+	retry := warmer.HandleMessages(context.Background(), []QueueRecord{
+		{MessageID: "1", Body: message("done", time.Minute)},
+		{MessageID: "2", Body: message("pending", time.Minute)},
+		{MessageID: "3", Body: message("stale", time.Hour)},
+		{MessageID: "4", Body: message("unknown", time.Minute)},
+		{MessageID: "5", Body: "not json"},
+	})
+	if !slices.Equal(retry, []string{"2", "4"}) {
+		t.Errorf("expected pending and failed checks to be retried, got %q", retry)
+	}
+	if warmed.Load() != 1 {
+		t.Errorf("expected the completed invalidation to be warmed once, got %d requests", warmed.Load())
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// minCompressSize is the smallest body worth compressing, below it the encoding overhead outweighs the savings
+	minCompressSize = 1024
+	// maxBufferedSize bounds the memory held per response, it fits the largest post. Larger responses are
+	// streamed as they're written, without an ETag or compression
+	maxBufferedSize = 4 << 20
+)
+
+// contentEncoding is a Content-Encoding the API can compress responses with
+type contentEncoding struct {
+	Name   string
+	Encode func(w io.Writer, body []byte) error
+}
+
+// contentEncodings are the supported encodings by server preference, clients' q-values take precedence
+var contentEncodings = []contentEncoding{
+	{Name: "br", Encode: encodeBrotli},
+	{Name: "gzip", Encode: encodeGzip},
+}
+
+// brotliLevel trades some ratio for speed as responses are compressed on every cache miss
+const brotliLevel = 5
+
+var (
+	brotliWriters = sync.Pool{New: func() any { return brotli.NewWriterLevel(io.Discard, brotliLevel) }}
+	gzipWriters   = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+)
+
+func encodeBrotli(w io.Writer, body []byte) error {
+	br := brotliWriters.Get().(*brotli.Writer)
+	defer brotliWriters.Put(br)
+	br.Reset(w)
+	if _, err := br.Write(body); err != nil {
+		return err
+	}
+	return br.Close()
+}
+
+func encodeGzip(w io.Writer, body []byte) error {
+	gz := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(gz)
+	gz.Reset(w)
+	if _, err := gz.Write(body); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// CompressionMiddleware buffers responses to give successful GETs a strong ETag derived from their content,
+// answering If-None-Match (or If-Modified-Since when the handler set Last-Modified) with 304, and compresses
+// text bodies with the encoding negotiated from Accept-Encoding. Each encoding is a distinct representation
+// with its own ETag. Responses the handler already encoded are left alone, responses past maxBufferedSize
+// are streamed untouched.
+// The ETag is only known once the handler ran, so a 304 saves the transfer of the body, not the reads
+// behind it, those are absorbed by the read cache and the CDN
+func CompressionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK, size: -1}
+		c.Writer = writer
+		defer func() { c.Writer = writer.ResponseWriter }()
+		c.Next()
+		writer.finish(c.Request)
+	}
+}
+
+// bufferedWriter holds the response until the handlers are done, mirroring the written state of gin's writer
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status    int
+	size      int
+	body      bytes.Buffer
+	streaming bool // the buffer overflowed, writes go straight to the client
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.Written() {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+	}
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	if !w.streaming && w.body.Len()+len(data) > maxBufferedSize {
+		w.stream()
+	}
+	var n int
+	var err error
+	if w.streaming {
+		n, err = w.ResponseWriter.Write(data)
+	} else {
+		n, err = w.body.Write(data)
+	}
+	w.size += n
+	return n, err
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// stream sends the status, the headers and what was buffered so far, later writes aren't buffered
+func (w *bufferedWriter) stream() {
+	w.streaming = true
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+	if w.body.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+	}
+	w.body = bytes.Buffer{}
+}
+
+func (w *bufferedWriter) Status() int   { return w.status }
+func (w *bufferedWriter) Size() int     { return w.size }
+func (w *bufferedWriter) Written() bool { return w.size != -1 }
+func (w *bufferedWriter) Flush() {
+	w.WriteHeaderNow()
+	if w.streaming {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *bufferedWriter) finish(request *http.Request) {
+	if w.streaming {
+		return
+	}
+	header := w.Header()
+	body := w.body.Bytes()
+	status := w.status
+	encoded := header.Get("Content-Encoding") != ""
+	var encoding *contentEncoding
+	if !encoded && status != http.StatusNotModified && compressible(header.Get("Content-Type")) {
+		if !slices.ContainsFunc(header.Values("Vary"), func(value string) bool { return varies(value, "Accept-Encoding") }) {
+			header.Add("Vary", "Accept-Encoding")
+		}
+		if len(body) >= minCompressSize {
+			encoding = negotiateEncoding(request.Header.Get("Accept-Encoding"))
+		}
+	}
+	if request.Method == http.MethodGet && status == http.StatusOK && !encoded {
+		etag := header.Get("ETag")
+		if etag == "" {
+			etag = contentETag(body)
+		}
+		if encoding != nil {
+			etag = representationETag(etag, encoding.Name)
+		}
+		header.Set("ETag", etag)
+		lastModified, _ := http.ParseTime(header.Get("Last-Modified"))
+		if notModified(request, etag, lastModified) {
+			header.Del("Content-Length")
+			w.ResponseWriter.WriteHeader(http.StatusNotModified)
+			w.ResponseWriter.WriteHeaderNow()
+			return
+		}
+	}
+	if encoding != nil {
+		var compressed bytes.Buffer
+		if err := encoding.Encode(&compressed, body); err == nil {
+			header.Set("Content-Encoding", encoding.Name)
+			body = compressed.Bytes()
+		}
+	}
+	if w.Written() && status != http.StatusNotModified && status != http.StatusNoContent {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.ResponseWriter.WriteHeader(status)
+	if !w.Written() {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+	if len(body) > 0 {
+		_, _ = w.ResponseWriter.Write(body)
+	}
+}
+
+// compressible tells whether a content type is text worth compressing, binary formats are left alone
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") || mediaType == "application/javascript"
+}
+
+// negotiateEncoding picks the supported encoding with the highest q-value in Accept-Encoding, ties go to
+// server preference. nil means identity
+func negotiateEncoding(acceptEncoding string) *contentEncoding {
+	qualities := map[string]float64{}
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(entry, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		quality := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		qualities[name] = quality
+	}
+	var best *contentEncoding
+	bestQuality := 0.0
+	for i := range contentEncodings {
+		quality, ok := qualities[contentEncodings[i].Name]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = &contentEncodings[i], quality
+		}
+	}
+	return best
+}
+
+// contentETag is a strong ETag derived from a response body
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// representationETag distinguishes the ETag of an encoded representation, as strong ETags must differ between them
+func representationETag(etag, encoding string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
+
+// notModified evaluates the conditional headers of a GET request, If-None-Match takes precedence over If-Modified-Since
+func notModified(request *http.Request, etag string, lastModified time.Time) bool {
+	if match := request.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == strings.TrimPrefix(etag, "W/") || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(request.Header.Get("If-Modified-Since"))
+	return err == nil && !lastModified.IsZero() && !lastModified.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCompressionAndConditionalGet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(NewCachePolicies(nil).Middleware(), CompressionMiddleware())
+	description := strings.Repeat("compressible ", 200)
+	router.GET("/blog/v1/posts/:slug", func(c *gin.Context) {
+		c.JSON(200, Post{Slug: c.Param("slug"), Description: description})
+	})
+
+	request := httptest.NewRequest("GET", "/blog/v1/posts/a", nil)
+	request.Header.Set("Accept-Encoding", "br;q=0.5, gzip;q=0.8")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	etag := recorder.Header().Get("ETag")
+	if recorder.Header().Get("Content-Encoding") != "gzip" || !strings.HasSuffix(etag, `-gzip"`) {
+		t.Fatalf("expected a gzip representation, got %q with ETag %q", recorder.Header().Get("Content-Encoding"), etag)
+	}
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(reader)
+	if !strings.Contains(string(body), description) {
+		t.Errorf("unexpected decompressed body %s", body)
+	}
+
+	request.Header.Set("If-None-Match", "W/"+etag)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != 304 || recorder.Body.Len() != 0 || recorder.Header().Get("Cache-Control") == "no-store" {
+		t.Errorf("expected a cacheable empty 304, got %d with %d bytes", recorder.Code, recorder.Body.Len())
+	}
+
+	request = httptest.NewRequest("GET", "/blog/v1/posts/a", nil)
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != 200 || recorder.Header().Get("Content-Encoding") != "" || recorder.Header().Get("ETag") == etag {
+		t.Errorf("the identity representation should have its own ETag, got %d with %q", recorder.Code, recorder.Header().Get("ETag"))
+	}
+	if got := recorder.Header().Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding" {
+		t.Errorf("expected Vary to list Accept-Encoding once, got %q", got)
+	}
+
+	request = httptest.NewRequest("GET", "/blog/v1/posts/a", nil)
+	request.Header.Set("Accept-Encoding", "gzip, deflate, br, zstd")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Header().Get("Content-Encoding") != "br" || !strings.HasSuffix(recorder.Header().Get("ETag"), `-br"`) {
+		t.Fatalf("expected a brotli representation, got %q", recorder.Header().Get("Content-Encoding"))
+	}
+	body, _ = io.ReadAll(brotli.NewReader(recorder.Body))
+	if !strings.Contains(string(body), description) {
+		t.Errorf("unexpected decompressed body %s", body)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                        "",
+		"gzip, deflate, br":       "br",
+		"gzip, deflate":           "gzip",
+		"br;q=0.5, gzip":          "gzip",
+		"gzip;q=0":                "",
+		"*":                       "br",
+		"identity, *;q=0":         "",
+		"deflate;q=1, gzip;q=0.1": "gzip",
+	}
+	for header, want := range cases {
+		got := ""
+		if encoding := negotiateEncoding(header); encoding != nil {
+			got = encoding.Name
+		}
+		if got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompressionStreamsLargeResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CompressionMiddleware())
+	chunk := strings.Repeat("x", maxBufferedSize/2)
+	router.GET("/sitemap.xml", func(c *gin.Context) {
+		c.Header("Content-Type", "application/xml")
+		for range 3 {
+			_, _ = c.Writer.WriteString(chunk)
+		}
+	})
+
+	request := httptest.NewRequest("GET", "/sitemap.xml", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != 200 || recorder.Body.Len() != 3*len(chunk) {
+		t.Fatalf("expected the whole body to be streamed, got %d with %d bytes", recorder.Code, recorder.Body.Len())
+	}
+	if recorder.Header().Get("Content-Encoding") != "" || recorder.Header().Get("ETag") != "" {
+		t.Errorf("expected a response past the buffer limit to be sent untouched, got %v", recorder.Header())
+	}
+}
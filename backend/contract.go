@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContractValidator checks requests, and optionally responses, against the OpenAPI document
+type ContractValidator struct {
+	document          *OpenAPIDocument
+	validateResponses bool
+}
+
+// NewContractValidator validates responses only in the dev and test environments,
+// response bodies have to be buffered for it
+func NewContractValidator(document *OpenAPIDocument) *ContractValidator {
+	environment := os.Getenv("ENVIRONMENT")
+	return &ContractValidator{
+		document:          document,
+		validateResponses: environment == "dev" || environment == "test",
+	}
+}
+
+// Middleware rejects requests breaking the contract of the matched operation with a validation error
+// and reports responses breaking it, every violation is recorded as a span event
+func (cv *ContractValidator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		operation, ok := cv.document.Paths[openapiPath(c.FullPath())][strings.ToLower(c.Request.Method)]
+		if !ok {
+			c.Next()
+			return
+		}
+		if violations := cv.validateRequest(c, operation); len(violations) > 0 {
+			recordViolations(c, "request", violations)
+			abortWithError(c, &ValidationError{Message: "Request doesn't match the API contract", Fields: violations})
+			return
+		}
+		if !cv.validateResponses {
+			c.Next()
+			return
+		}
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		if violations := cv.validateResponse(operation, recorder); len(violations) > 0 {
+			recordViolations(c, "response", violations)
+		}
+	}
+}
+
+func (cv *ContractValidator) validateRequest(c *gin.Context, operation Operation) []FieldError {
+	var violations []FieldError
+	for _, parameter := range operation.Parameters {
+		var value string
+		var present bool
+		switch parameter.In {
+		case "path":
+			value = c.Param(parameter.Name)
+			present = value != ""
+		case "query":
+			value, present = c.GetQuery(parameter.Name)
+		}
+		if !present {
+			if parameter.Required {
+				violations = append(violations, FieldError{Field: parameter.Name, Message: "is required"})
+			}
+			continue
+		}
+		parsed, err := parseParameter(value, parameter.Schema)
+		if err != nil {
+			violations = append(violations, FieldError{Field: parameter.Name, Message: err.Error()})
+			continue
+		}
+		violations = append(violations, cv.validateValue(parsed, parameter.Schema, parameter.Name)...)
+	}
+
+	if operation.RequestBody == nil {
+		return violations
+	}
+	media, ok := operation.RequestBody.Content["application/json"]
+	if !ok {
+		return violations
+	}
+	raw, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return append(violations, FieldError{Field: "body", Message: "can't be read"})
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return append(violations, FieldError{Field: "body", Message: "is required"})
+	}
+	body, err := decodeJSON(raw)
+	if err != nil {
+		return append(violations, FieldError{Field: "body", Message: "must be valid JSON"})
+	}
+	return append(violations, cv.validateValue(body, media.Schema, "")...)
+}
+
+func (cv *ContractValidator) validateResponse(operation Operation, recorder *responseRecorder) []FieldError {
+	// errors are rendered from RestError by ProblemMiddleware once the handler chain has returned
+	if !recorder.Written() || recorder.Status() == http.StatusNotModified {
+		return nil
+	}
+	response, ok := operation.Responses[strconv.Itoa(recorder.Status())]
+	if !ok {
+		response = operation.Responses["default"]
+	}
+	contentType, _, _ := strings.Cut(recorder.Header().Get("Content-Type"), ";")
+	media, ok := response.Content[contentType]
+	if !ok {
+		return []FieldError{{Field: "Content-Type", Message: fmt.Sprintf("%q isn't documented for status %d", contentType, recorder.Status())}}
+	}
+	if !strings.HasSuffix(contentType, "json") {
+		return nil
+	}
+	body, err := decodeJSON(recorder.body.Bytes())
+	if err != nil {
+		return []FieldError{{Field: "body", Message: "must be valid JSON"}}
+	}
+	return cv.validateValue(body, media.Schema, "")
+}
+
+// validateValue checks a decoded JSON value against a schema, field paths read like "posts[2].title"
+func (cv *ContractValidator) validateValue(value any, schema *Schema, field string) []FieldError {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		return cv.validateValue(value, cv.document.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")], field)
+	}
+	if value == nil {
+		if schema.Nullable || (schema.Type == "" && len(schema.AllOf) == 0) {
+			return nil
+		}
+		return []FieldError{{Field: fieldName(field), Message: "must not be null"}}
+	}
+	var violations []FieldError
+	for _, nested := range schema.AllOf {
+		violations = append(violations, cv.validateValue(value, nested, field)...)
+	}
+	fail := func(format string, args ...any) []FieldError {
+		return append(violations, FieldError{Field: fieldName(field), Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fail("must be an object")
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				violations = append(violations, FieldError{Field: joinField(field, name), Message: "is required"})
+			}
+		}
+		for name, property := range object {
+			if propertySchema, ok := schema.Properties[name]; ok {
+				violations = append(violations, cv.validateValue(property, propertySchema, joinField(field, name))...)
+			} else if schema.AdditionalProperties != nil {
+				violations = append(violations, cv.validateValue(property, schema.AdditionalProperties, joinField(field, name))...)
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fail("must be an array")
+		}
+		if schema.MinItems != nil && len(array) < *schema.MinItems {
+			return fail("must have at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(array) > *schema.MaxItems {
+			return fail("must have at most %d items", *schema.MaxItems)
+		}
+		for i, item := range array {
+			violations = append(violations, cv.validateValue(item, schema.Items, fmt.Sprintf("%s[%d]", field, i))...)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return fail("must be a string")
+		}
+		length := utf8.RuneCountInString(text)
+		switch {
+		case schema.MinLength != nil && length < *schema.MinLength:
+			return fail("must be at least %d characters", *schema.MinLength)
+		case schema.MaxLength != nil && length > *schema.MaxLength:
+			return fail("must be at most %d characters", *schema.MaxLength)
+		case len(schema.Enum) > 0 && !slices.Contains(schema.Enum, text):
+			return fail("must be one of: %s", strings.Join(schema.Enum, ", "))
+		case schema.Format == "date" && !isDate(text, time.DateOnly):
+			return fail("must be a date formatted as %s", time.DateOnly)
+		case schema.Format == "date-time" && !isDate(text, time.RFC3339):
+			return fail("must be an RFC 3339 timestamp")
+		}
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fail("must be a number")
+		}
+		parsed, err := number.Float64()
+		if err != nil {
+			return fail("must be a number")
+		}
+		switch {
+		case schema.Type == "integer" && parsed != math.Trunc(parsed):
+			return fail("must be an integer")
+		case schema.Minimum != nil && parsed < *schema.Minimum:
+			return fail("must be at least %v", *schema.Minimum)
+		case schema.Maximum != nil && parsed > *schema.Maximum:
+			return fail("must be at most %v", *schema.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("must be a boolean")
+		}
+	}
+	return violations
+}
+
+// parseParameter converts a path or query value to the JSON value its schema describes
+func parseParameter(value string, schema *Schema) (any, error) {
+	switch schema.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return json.Number(value), nil
+	case "boolean":
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return parsed, nil
+	default:
+		return value, nil
+	}
+}
+
+// recordViolations adds a span event per contract violation and logs them together
+func recordViolations(c *gin.Context, direction string, violations []FieldError) {
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+	for _, violation := range violations {
+		span.AddEvent("contract.violation", trace.WithAttributes(
+			attribute.String("contract.direction", direction),
+			attribute.String("contract.route", c.Request.Method+" "+c.FullPath()),
+			attribute.String("contract.field", violation.Field),
+			attribute.String("contract.message", violation.Message),
+		))
+	}
+	slog.WarnContext(ctx, "API contract violation", "Direction", direction, "Path", c.FullPath(), "Violations", violations)
+}
+
+// responseRecorder keeps a copy of the response body while it's written to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(data string) (int, error) {
+	r.body.WriteString(data)
+	return r.ResponseWriter.WriteString(data)
+}
+
+func decodeJSON(raw []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func fieldName(field string) string {
+	if field == "" {
+		return "body"
+	}
+	return field
+}
+
+func isDate(value, layout string) bool {
+	_, err := time.Parse(layout, value)
+	return err == nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newContractRouter serves a route of the table with a stub handler behind the contract validator
+func newContractRouter(t *testing.T, method, path string, handler gin.HandlerFunc) *gin.Engine {
+	t.Setenv("ENVIRONMENT", "test")
+	bc := newTestController()
+	validator := NewContractValidator(bc.openapi())
+	router := gin.New()
+	router.Use(ProblemMiddleware())
+	router.Handle(method, path, validator.Middleware(), handler)
+	return router
+}
+
+func TestContractRejectsInvalidRequests(t *testing.T) {
+	router := newContractRouter(t, "PUT", "/blog/posts", func(c *gin.Context) {
+		c.JSON(http.StatusOK, MessageResponse{Message: "ok"})
+	})
+	body := `{"title": "t", "tags": "go", "created_at": "2024-01-01", "description": "d"}`
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("PUT", "/blog/posts", strings.NewReader(body)))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", recorder.Code)
+	}
+	var problem RestError
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]bool{}
+	for _, fieldError := range problem.Errors {
+		fields[fieldError.Field] = true
+	}
+	if !fields["slug"] || !fields["tags"] {
+		t.Errorf("expected slug and tags violations, got %+v", problem.Errors)
+	}
+}
+
+func TestContractRejectsInvalidQuery(t *testing.T) {
+	router := newContractRouter(t, "GET", "/blog/posts", func(c *gin.Context) {
+		c.JSON(http.StatusOK, ListPosts{})
+	})
+	for _, query := range []string{"limit=abc", "limit=100", "sort=random", "from=01-01-2024"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", "/blog/posts?"+query, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, recorder.Code)
+		}
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/blog/posts?limit=3&sort=asc&from=2024-01-01", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", recorder.Code)
+	}
+}
+
+func TestContractReportsInvalidResponses(t *testing.T) {
+	bc := newTestController()
+	validator := NewContractValidator(bc.openapi())
+	operation := bc.openapi().Paths["/blog/posts"]["get"]
+	valid, _ := decodeJSON([]byte(`{"items": [], "nextCursor": "", "prevCursor": ""}`))
+	if violations := validator.validateValue(valid, operation.Responses["200"].Content["application/json"].Schema, ""); len(violations) > 0 {
+		t.Errorf("unexpected violations %+v", violations)
+	}
+	invalid, _ := decodeJSON([]byte(`{"items": [{"slug": 1}], "nextCursor": ""}`))
+	violations := validator.validateValue(invalid, operation.Responses["200"].Content["application/json"].Schema, "")
+	fields := map[string]bool{}
+	for _, violation := range violations {
+		fields[violation.Field] = true
+	}
+	if !fields["prevCursor"] || !fields["items[0].slug"] || !fields["items[0].title"] {
+		t.Errorf("unexpected violations %+v", violations)
+	}
+}
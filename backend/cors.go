@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultCorsMaxAge is how long browsers may cache a preflight in seconds, Chromium caps it at 2 hours
+const defaultCorsMaxAge = 7200
+
+var (
+	corsAllowedMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	corsAllowedHeaders = []string{
+		"Authorization", "Content-Type", "If-None-Match", "If-Modified-Since", "X-API-Key",
+		"Connect-Protocol-Version", "Connect-Timeout-Ms",
+	}
+	// corsExposedHeaders are the response headers scripts may read besides the CORS safelisted ones
+	corsExposedHeaders = []string{"ETag", "Link", "Deprecation", "Sunset", "Retry-After"}
+)
+
+// CorsPolicy decides which origins may call the API from a browser. CORS is only handled here, the Lambda URL
+// must not add its own headers or browsers reject the duplicates
+type CorsPolicy struct {
+	origins   []string // exact origins e.g. https://example.com
+	wildcards []corsWildcard
+	anyOrigin bool
+	maxAge    int
+}
+
+// corsWildcard allows the subdomains of a domain, Suffix is the domain with a leading dot e.g. .example.com
+type corsWildcard struct {
+	Scheme string
+	Suffix string
+}
+
+// NewCorsPolicyFromEnv reads ALLOWED_ORIGINS, a comma separated list of origins where "https://*.example.com"
+// allows any subdomain of example.com and "*" any origin, and CORS_MAX_AGE, the preflight cache duration in seconds
+func NewCorsPolicyFromEnv() *CorsPolicy {
+	policy := &CorsPolicy{maxAge: envInt("CORS_MAX_AGE", defaultCorsMaxAge, 1)}
+	for _, entry := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+		entry = strings.TrimSuffix(strings.TrimSpace(entry), "/")
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			policy.anyOrigin = true
+			continue
+		}
+		origin, err := url.Parse(entry)
+		if err != nil || origin.Scheme == "" || origin.Host == "" || origin.Path != "" {
+			slog.Warn("Ignoring invalid ALLOWED_ORIGINS entry", "Entry", entry)
+			continue
+		}
+		if suffix, found := strings.CutPrefix(origin.Host, "*."); found {
+			policy.wildcards = append(policy.wildcards, corsWildcard{Scheme: strings.ToLower(origin.Scheme), Suffix: "." + strings.ToLower(suffix)})
+			continue
+		}
+		policy.origins = append(policy.origins, strings.ToLower(origin.Scheme+"://"+origin.Host))
+	}
+	slog.Info("Allowed origins", "Origins", policy.origins, "Wildcards", policy.wildcards, "Any", policy.anyOrigin)
+	return policy
+}
+
+// Allows tells whether a browser on origin may call the API, wildcards match subdomains at any depth but not the domain itself
+func (p *CorsPolicy) Allows(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if slices.Contains(p.origins, origin) {
+		return true
+	}
+	scheme, host, found := strings.Cut(origin, "://")
+	if !found {
+		return false
+	}
+	for _, wildcard := range p.wildcards {
+		if scheme == wildcard.Scheme && strings.HasSuffix(host, wildcard.Suffix) && len(host) > len(wildcard.Suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware sets the CORS headers of allowed origins and answers preflights, before the handlers so error
+// responses are readable too. Headers are set rather than added so they're never sent twice. Responses vary
+// by Origin as the allowed origin is echoed back, the CDN keys its cache on Origin for it
+func (p *CorsPolicy) Middleware() gin.HandlerFunc {
+	allowMethods := strings.Join(corsAllowedMethods, ", ")
+	allowHeaders := strings.Join(corsAllowedHeaders, ", ")
+	exposeHeaders := strings.Join(corsExposedHeaders, ", ")
+	maxAge := strconv.Itoa(p.maxAge)
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		if !p.anyOrigin && !slices.ContainsFunc(header.Values("Vary"), func(value string) bool { return varies(value, "Origin") }) {
+			header.Add("Vary", "Origin")
+		}
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if origin == "" || !p.Allows(origin) {
+			if preflight {
+				// without the CORS headers the browser blocks the actual request
+				c.AbortWithStatus(http.StatusNoContent)
+			}
+			return
+		}
+		if p.anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if !preflight {
+			header.Set("Access-Control-Expose-Headers", exposeHeaders)
+			return
+		}
+		header.Set("Access-Control-Allow-Methods", allowMethods)
+		header.Set("Access-Control-Allow-Headers", allowHeaders)
+		header.Set("Access-Control-Max-Age", maxAge)
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCorsPolicyAllows(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGINS", "https://cloudificando.com/, https://*.preview.cloudificando.com,http://localhost:3000,not an origin")
+	policy := NewCorsPolicyFromEnv()
+	cases := map[string]bool{
+		"https://cloudificando.com":                 true,
+		"https://CLOUDIFICANDO.com":                 true,
+		"http://cloudificando.com":                  false,
+		"https://pr-1.preview.cloudificando.com":    true,
+		"https://a.b.preview.cloudificando.com":     true,
+		"https://preview.cloudificando.com":         false,
+		"http://pr-1.preview.cloudificando.com":     false,
+		"https://evilpreview.cloudificando.com":     false,
+		"https://preview.cloudificando.com.evil.io": false,
+		"http://localhost:3000":                     true,
+		"http://localhost:4000":                     false,
+	}
+	for origin, want := range cases {
+		if got := policy.Allows(origin); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestCorsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("ALLOWED_ORIGINS", "https://*.cloudificando.com")
+	t.Setenv("CORS_MAX_AGE", "600")
+	router := gin.New()
+	router.Use(NewCorsPolicyFromEnv().Middleware(), ProblemMiddleware())
+	router.GET("/blog/v1/posts/:slug", func(c *gin.Context) {
+		abortWithError(c, &NotFoundError{Resource: "post", Key: c.Param("slug")})
+	})
+	router.NoRoute(func(c *gin.Context) {
+		abortWithError(c, &NotFoundError{Resource: "route", Key: c.Request.URL.Path})
+	})
+	send := func(method, origin string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/blog/v1/posts/missing", nil)
+		request.Header.Set("Origin", origin)
+		if method == "OPTIONS" {
+			request.Header.Set("Access-Control-Request-Method", "PUT")
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := send("OPTIONS", "https://www.cloudificando.com")
+	header := recorder.Header()
+	if recorder.Code != 204 || header.Get("Access-Control-Allow-Origin") != "https://www.cloudificando.com" || header.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("unexpected preflight %d %v", recorder.Code, header)
+	}
+	if len(header.Values("Access-Control-Allow-Origin")) != 1 || header.Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("expected the preflight headers once, got %v", header)
+	}
+
+	recorder = send("GET", "https://www.cloudificando.com")
+	if recorder.Code != 404 || recorder.Header().Get("Access-Control-Allow-Origin") != "https://www.cloudificando.com" {
+		t.Errorf("errors should be readable by allowed origins, got %d %v", recorder.Code, recorder.Header())
+	}
+	if recorder.Header().Get("Vary") != "Origin" {
+		t.Errorf("expected responses to vary by Origin, got %q", recorder.Header().Get("Vary"))
+	}
+
+	recorder = send("OPTIONS", "https://cloudificando.evil.io")
+	if recorder.Code != 204 || recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflights of other origins shouldn't be allowed, got %d %v", recorder.Code, recorder.Header())
+	}
+}
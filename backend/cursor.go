@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	dynamoType "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// cursorVersion must be bumped whenever the key schema behind a cursor changes,
+// so cursors issued by an older build are rejected instead of silently misread.
+const cursorVersion = 2
+
+// ErrInvalidCursor is returned when a cursor is malformed, tampered with, outdated
+// or was issued for a different query.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CursorQuery identifies the query a cursor was issued for, a cursor is only valid for the same query
+type CursorQuery struct {
+	Tag   string `json:"t,omitempty"`
+	Sort  string `json:"s"`
+	Limit int    `json:"l"`
+	From  string `json:"f,omitempty"`
+	To    string `json:"u,omitempty"`
+}
+
+// CursorDirection tells whether a cursor points to the page after or before the one it was issued on
+type CursorDirection string
+
+const (
+	CursorNext CursorDirection = "next"
+	CursorPrev CursorDirection = "prev"
+)
+
+// Cursor represents the pagination cursor with PK and SK as strings
+type Cursor struct {
+	PK     string `json:"PK"`
+	SK     string `json:"SK"`
+	SKLSI1 string `json:"SK_LSI1"`
+}
+
+type cursorPayload struct {
+	Version   int             `json:"v"`
+	Query     CursorQuery     `json:"q"`
+	Direction CursorDirection `json:"d"`
+	Key       Cursor          `json:"k"`
+}
+
+// CursorCodec turns LastEvaluatedKeys into opaque, HMAC-signed cursors and back
+type CursorCodec struct {
+	secret []byte
+}
+
+func NewCursorCodec(secret []byte) *CursorCodec {
+	return &CursorCodec{secret: secret}
+}
+
+// Encode signs the ExclusiveStartKey together with the query and direction it belongs to,
+// key may be a whole LSI1 item since only its key attributes are kept
+func (cc *CursorCodec) Encode(query CursorQuery, direction CursorDirection, key map[string]dynamoType.AttributeValue) (string, error) {
+	pkAttr, ok := key["PK"].(*dynamoType.AttributeValueMemberS)
+	if !ok {
+		return "", errors.New("invalid cursor: missing or invalid PK")
+	}
+	skAttr, ok := key["SK"].(*dynamoType.AttributeValueMemberS)
+	if !ok {
+		return "", errors.New("invalid cursor: missing or invalid SK")
+	}
+	sklsi1Attr, ok := key["SK_LSI1"].(*dynamoType.AttributeValueMemberS)
+	if !ok {
+		return "", errors.New("invalid cursor: missing or invalid SK_LSI1")
+	}
+	payload := cursorPayload{
+		Version:   cursorVersion,
+		Query:     query,
+		Direction: direction,
+		Key: Cursor{
+			PK:     pkAttr.Value,
+			SK:     skAttr.Value,
+			SKLSI1: sklsi1Attr.Value,
+		},
+	}
+	marshaled, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cursor: %w", err)
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(marshaled)
+	encodedSignature := base64.RawURLEncoding.EncodeToString(cc.sign(marshaled))
+	return encodedPayload + "." + encodedSignature, nil
+}
+
+// Decode verifies the cursor signature, version and query binding and returns the ExclusiveStartKey
+// along with the direction to read in
+func (cc *CursorCodec) Decode(query CursorQuery, cursor string) (map[string]dynamoType.AttributeValue, CursorDirection, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(cursor, ".")
+	if !found {
+		return nil, "", invalidCursorError("malformed")
+	}
+	marshaled, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, "", invalidCursorError("malformed")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, "", invalidCursorError("malformed")
+	}
+	if !hmac.Equal(signature, cc.sign(marshaled)) {
+		return nil, "", invalidCursorError("signature mismatch")
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(marshaled, &payload); err != nil {
+		return nil, "", invalidCursorError("malformed")
+	}
+	if payload.Version != cursorVersion {
+		return nil, "", invalidCursorError(fmt.Sprintf("unsupported version %d", payload.Version))
+	}
+	if payload.Direction != CursorNext && payload.Direction != CursorPrev {
+		return nil, "", invalidCursorError("unknown direction")
+	}
+	if payload.Query != query {
+		return nil, "", invalidCursorError("issued for a different query")
+	}
+	if payload.Key.PK != postsPartitionKey(query.Tag) {
+		return nil, "", invalidCursorError("issued for a different partition")
+	}
+
+	key := map[string]dynamoType.AttributeValue{
+		"PK":      &dynamoType.AttributeValueMemberS{Value: payload.Key.PK},
+		"SK":      &dynamoType.AttributeValueMemberS{Value: payload.Key.SK},
+		"SK_LSI1": &dynamoType.AttributeValueMemberS{Value: payload.Key.SKLSI1},
+	}
+	return key, payload.Direction, nil
+}
+
+// invalidCursorError reports a rejected cursor as a validation error on the cursor parameter
+func invalidCursorError(reason string) error {
+	return &ValidationError{
+		Message: "Invalid cursor",
+		Fields:  []FieldError{{Field: "cursor", Message: reason}},
+		Err:     ErrInvalidCursor,
+	}
+}
+
+func (cc *CursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, cc.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
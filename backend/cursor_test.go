@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	dynamoType "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func cursorKey(pk, sk, lsi1 string) map[string]dynamoType.AttributeValue {
+	return map[string]dynamoType.AttributeValue{
+		"PK":      &dynamoType.AttributeValueMemberS{Value: pk},
+		"SK":      &dynamoType.AttributeValueMemberS{Value: sk},
+		"SK_LSI1": &dynamoType.AttributeValueMemberS{Value: lsi1},
+		"title":   &dynamoType.AttributeValueMemberS{Value: "dropped from the cursor"},
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	codec := NewCursorCodec([]byte("secret"))
+	query := CursorQuery{Tag: "go", Sort: SortDesc, Limit: 6, From: "2024-01-01"}
+	for _, direction := range []CursorDirection{CursorNext, CursorPrev} {
+		cursor, err := codec.Encode(query, direction, cursorKey("TAG#go", "POST#hello", "2024-03-01#hello"))
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		key, decoded, err := codec.Decode(query, cursor)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", direction, err)
+		}
+		if decoded != direction {
+			t.Errorf("expected direction %s, got %s", direction, decoded)
+		}
+		if len(key) != 3 || key["SK_LSI1"].(*dynamoType.AttributeValueMemberS).Value != "2024-03-01#hello" {
+			t.Errorf("%s: expected only the key attributes, got %v", direction, key)
+		}
+	}
+}
+
+func TestCursorRejections(t *testing.T) {
+	codec := NewCursorCodec([]byte("secret"))
+	query := CursorQuery{Tag: "go", Sort: SortDesc, Limit: 6, From: "2024-01-01", To: "2024-12-31"}
+	cursor, err := codec.Encode(query, CursorNext, cursorKey("TAG#go", "POST#hello", "2024-03-01#hello"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	encodedPayload, signature, _ := strings.Cut(cursor, ".")
+	// resign lets a case forge a payload as if the secret leaked, so checks past the signature are exercised
+	resign := func(payload cursorPayload) string {
+		marshaled, _ := json.Marshal(payload)
+		return base64.RawURLEncoding.EncodeToString(marshaled) + "." + base64.RawURLEncoding.EncodeToString(codec.sign(marshaled))
+	}
+	valid := cursorPayload{Version: cursorVersion, Query: query, Direction: CursorNext, Key: Cursor{PK: "TAG#go", SK: "POST#hello", SKLSI1: "2024-03-01#hello"}}
+	tampered, _ := json.Marshal(cursorPayload{Version: cursorVersion, Query: query, Direction: CursorNext, Key: Cursor{PK: "TAG#go", SK: "POST#other", SKLSI1: "2099-01-01#other"}})
+
+	cases := map[string]struct {
+		query  CursorQuery
+		cursor string
+	}{
+		"no separator":      {query, encodedPayload},
+		"bad base64":        {query, "!!!." + signature},
+		"tampered payload":  {query, base64.RawURLEncoding.EncodeToString(tampered) + "." + signature},
+		"other secret":      {query, mustEncode(t, NewCursorCodec([]byte("other")), query)},
+		"other tag":         {CursorQuery{Tag: "rust", Sort: SortDesc, Limit: 6, From: "2024-01-01", To: "2024-12-31"}, cursor},
+		"other sort":        {CursorQuery{Tag: "go", Sort: SortAsc, Limit: 6, From: "2024-01-01", To: "2024-12-31"}, cursor},
+		"other limit":       {CursorQuery{Tag: "go", Sort: SortDesc, Limit: 12, From: "2024-01-01", To: "2024-12-31"}, cursor},
+		"other range":       {CursorQuery{Tag: "go", Sort: SortDesc, Limit: 6, From: "2023-01-01", To: "2024-12-31"}, cursor},
+		"old version":       {query, resign(cursorPayload{Version: cursorVersion - 1, Query: valid.Query, Direction: valid.Direction, Key: valid.Key})},
+		"unknown direction": {query, resign(cursorPayload{Version: cursorVersion, Query: valid.Query, Direction: "sideways", Key: valid.Key})},
+		"other partition":   {query, resign(cursorPayload{Version: cursorVersion, Query: valid.Query, Direction: valid.Direction, Key: Cursor{PK: "POST", SK: "POST#hello"}})},
+	}
+	for name, tc := range cases {
+		if _, _, err := codec.Decode(tc.query, tc.cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", name, err)
+		}
+	}
+	if _, _, err := codec.Decode(query, resign(valid)); err != nil {
+		t.Errorf("the forged valid payload should decode, got %v", err)
+	}
+}
+
+func mustEncode(t *testing.T, codec *CursorCodec, query CursorQuery) string {
+	t.Helper()
+	cursor, err := codec.Encode(query, CursorNext, cursorKey(postsPartitionKey(query.Tag), "POST#hello", "2024-03-01#hello"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return cursor
+}
@@ -1,6 +1,10 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+
+	"cloudificando/ingestion"
+)
 
 // EventPostUpdatedRequest is the gcp pub/sub push-based subscription body send by gcp
 type EventPostUpdatedRequest struct {
@@ -9,35 +13,136 @@ type EventPostUpdatedRequest struct {
 		MessageId   string `json:"message_id" binding:"required"` // Post json Base 64 encoded
 		PublishTime string `json:"publish_time" binding:"required"`
 		Attributes  struct {
-			EventType string `json:"eventType" binding:"required"` // "POST_CREATED" ,"POST_DELETED", "CONTENT_UPDATED", "META_UPDATED"
+			EventType string `json:"eventType" binding:"required"` // "POST_CREATED" ,"POST_DELETED", "CONTENT_UPDATED", "META_UPDATED", data carries the post with its body
 			Slug      string `json:"slug" binding:"required"`
 		} `json:"attributes" binding:"required"`
 	} `json:"message" binding:"required"`
 	Subscription string `json:"subscription" binding:"required"`
 }
 type Post struct {
-	Title       string   `json:"title" dynamodbav:"title" binding:"required"`
-	Tags        []string `json:"tags" dynamodbav:"tags" binding:"required"`
-	CreatedAt   string   `json:"created_at" dynamodbav:"created_at" binding:"required"`
-	Description string   `json:"description" dynamodbav:"description" binding:"required"`
-	Slug        string   `json:"slug" dynamodbav:"slug" binding:"required"`
+	Title       string    `json:"title" dynamodbav:"title" binding:"required"`
+	Tags        []string  `json:"tags" dynamodbav:"tags" binding:"required"`
+	CreatedAt   string    `json:"created_at" dynamodbav:"created_at" binding:"required"`
+	UpdatedAt   string    `json:"updated_at,omitempty" dynamodbav:"updated_at,omitempty"` // RFC 3339, set by the repository when the post changes
+	Description string    `json:"description" dynamodbav:"description" binding:"required"`
+	Slug        string    `json:"slug" dynamodbav:"slug" binding:"required"`
+	Series      string    `json:"series,omitempty" dynamodbav:"series,omitempty"`             // optional multi-part series name
+	SeriesOrder int       `json:"series_order,omitempty" dynamodbav:"series_order,omitempty"` // 1-based position in the series
+	Body        string    `json:"body,omitempty" dynamodbav:"-"`                              // MDX body, stored compressed in BODY# chunks
+	BodyHash    string    `json:"-" dynamodbav:"body_sha256,omitempty"`                       // manifest of the stored body chunks
+	BodyChunks  int       `json:"-" dynamodbav:"body_chunks,omitempty"`
+	WordCount   int       `json:"word_count,omitempty" dynamodbav:"word_count,omitempty"`
+	ReadingTime int       `json:"reading_time,omitempty" dynamodbav:"reading_time,omitempty"` // minutes
+	Toc         []TocItem `json:"toc,omitempty" dynamodbav:"toc,omitempty"`
+}
+
+// TocItem is an entry of a post table of contents, shaped like the frontend TableOfContents
+type TocItem struct {
+	Title string    `json:"title" dynamodbav:"title"`
+	URL   string    `json:"url" dynamodbav:"url"`
+	Items []TocItem `json:"items,omitempty" dynamodbav:"items,omitempty"`
+}
+
+// ApplyBodyStats derives word count, reading time and table of contents from the post body
+func (p *Post) ApplyBodyStats() {
+	stats := ingestion.Analyze(p.Body)
+	p.WordCount = stats.WordCount
+	p.ReadingTime = stats.ReadingTime
+	p.Toc = newToc(stats.Headings)
+}
+
+// newToc nests headings under the closest preceding heading of a lower depth, skipped levels included
+func newToc(headings []ingestion.Heading) []TocItem {
+	type node struct {
+		depth    int
+		item     TocItem
+		children []*node
+	}
+	root := &node{}
+	// ancestors holds the path from the root to the last heading, each deeper than the previous
+	ancestors := []*node{root}
+	for _, heading := range headings {
+		for len(ancestors) > 1 && ancestors[len(ancestors)-1].depth >= heading.Depth {
+			ancestors = ancestors[:len(ancestors)-1]
+		}
+		child := &node{depth: heading.Depth, item: TocItem{Title: heading.Title, URL: "#" + heading.ID}}
+		parent := ancestors[len(ancestors)-1]
+		parent.children = append(parent.children, child)
+		ancestors = append(ancestors, child)
+	}
+	var items func(nodes []*node) []TocItem
+	items = func(nodes []*node) []TocItem {
+		var result []TocItem
+		for _, n := range nodes {
+			item := n.item
+			item.Items = items(n.children)
+			result = append(result, item)
+		}
+		return result
+	}
+	return items(root.children)
+}
+
+// NewPostFromDocument maps a parsed MDX document to a Post, the frontmatter date becomes created_at
+func NewPostFromDocument(document *ingestion.Document) Post {
+	frontmatter := document.Frontmatter
+	return Post{
+		Title:       frontmatter.Title,
+		Tags:        frontmatter.Tags,
+		CreatedAt:   frontmatter.Date,
+		Description: frontmatter.Description,
+		Slug:        document.Slug,
+		Series:      frontmatter.Series,
+		SeriesOrder: frontmatter.SeriesOrder,
+		Body:        document.Body,
+	}
 }
 
 type HardSyncRequest struct {
 	Posts []Post `json:"posts" binding:"required"`
 }
 
-type RestError struct {
+// MessageResponse is the body of successful writes
+type MessageResponse struct {
 	Message string `json:"message"`
-	Status  int    `json:"status"`
-	Error   string `json:"error"`
 }
 
-func BadRequestError(message string) *RestError {
+// QueueEvent is the SQS event the Lambda adapter posts for queue messages, see CacheWarmEventHandler
+type QueueEvent struct {
+	Records []QueueRecord `json:"Records" binding:"required"`
+}
+
+type QueueRecord struct {
+	MessageID string `json:"messageId" binding:"required"`
+	Body      string `json:"body"`
+}
+
+// QueueEventResponse reports the messages SQS should deliver again, the rest are deleted
+type QueueEventResponse struct {
+	BatchItemFailures []BatchItemFailure `json:"batchItemFailures"`
+}
+
+type BatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// RestError is the RFC 7807 problem details body of every error response
+type RestError struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	TraceID  string       `json:"traceId,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+func newProblem(status int, detail string) *RestError {
 	return &RestError{
-		Message: message,
-		Status:  http.StatusBadRequest,
-		Error:   "Invalid Request",
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
 	}
 }
 
@@ -52,7 +157,26 @@ type TagMetadata struct {
 	SK   string `dynamodbav:"SK"`
 	Slug string `dynamodbav:"slug"`
 }
+
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
 type ListPosts struct {
 	Items      []Post `json:"items"`
 	NextCursor string `json:"nextCursor"`
+	PrevCursor string `json:"prevCursor"`
+	Total      *int   `json:"total,omitempty"` // only when requested with count=true
+}
+
+// PostNeighbours are the posts published right before and after a post
+type PostNeighbours struct {
+	Previous *Post `json:"previous"`
+	Next     *Post `json:"next"`
+}
+
+type SeriesPosts struct {
+	Series string `json:"series"`
+	Items  []Post `json:"items"`
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"cloudificando/ingestion"
+)
+
+func TestNewToc(t *testing.T) {
+	heading := func(depth int, title string) ingestion.Heading {
+		return ingestion.Heading{Depth: depth, Title: title, ID: title}
+	}
+	item := func(title string, items ...TocItem) TocItem {
+		return TocItem{Title: title, URL: "#" + title, Items: items}
+	}
+
+	cases := map[string]struct {
+		headings []ingestion.Heading
+		want     []TocItem
+	}{
+		"empty": {},
+		"nested": {
+			headings: []ingestion.Heading{heading(2, "a"), heading(3, "b"), heading(3, "c"), heading(2, "d")},
+			want:     []TocItem{item("a", item("b"), item("c")), item("d")},
+		},
+		"skipped level": {
+			headings: []ingestion.Heading{heading(1, "a"), heading(3, "b"), heading(2, "c")},
+			want:     []TocItem{item("a", item("b"), item("c"))},
+		},
+		"decreasing levels": {
+			headings: []ingestion.Heading{heading(3, "a"), heading(2, "b"), heading(1, "c")},
+			want:     []TocItem{item("a"), item("b"), item("c")},
+		},
+		"back to a shallower level": {
+			headings: []ingestion.Heading{heading(2, "a"), heading(4, "b"), heading(3, "c"), heading(4, "d"), heading(2, "e")},
+			want:     []TocItem{item("a", item("b"), item("c", item("d"))), item("e")},
+		},
+	}
+	for name, tc := range cases {
+		if got := newToc(tc.headings); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %+v, got %+v", name, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeItem is an item as DynamoDB sends it on the wire, attribute name to typed value e.g. {"S": "POST"}
+type fakeItem map[string]map[string]any
+
+// fakeDynamo is an in-memory table answering the DynamoDB operations and expressions the repository uses
+type fakeDynamo struct {
+	mu    sync.Mutex
+	items map[string]map[string]fakeItem // PK to SK to item
+}
+
+// newFakeDynamo returns a repository backed by an empty in-memory table
+func newFakeDynamo(t *testing.T) (*fakeDynamo, *BlogRepository) {
+	t.Helper()
+	fake := &fakeDynamo{items: map[string]map[string]fakeItem{}}
+	repository := newFakeDynamoRepository(t, fake.ServeHTTP)
+	repository.cursors = NewCursorCodec([]byte("test secret"))
+	return fake, repository
+}
+
+// fakeRequest holds the fields of every operation the fake answers
+type fakeRequest struct {
+	Key                       fakeItem
+	Item                      fakeItem
+	ConditionExpression       string
+	KeyConditionExpression    string
+	UpdateExpression          string
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues fakeItem
+	IndexName                 string
+	ScanIndexForward          *bool
+	Limit                     int
+	ExclusiveStartKey         fakeItem
+	Select                    string
+	RequestItems              map[string][]struct {
+		PutRequest    *struct{ Item fakeItem }
+		DeleteRequest *struct{ Key fakeItem }
+	}
+	TransactItems []struct {
+		Put    *fakeRequest
+		Delete *fakeRequest
+		Update *fakeRequest
+	}
+}
+
+// errConditionFailed is returned by conditional writes whose condition doesn't hold
+var errConditionFailed = errors.New("the conditional request failed")
+
+func (f *fakeDynamo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request fakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		fakeDynamoError(w, "ValidationException", err.Error(), nil)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var response any
+	var err error
+	switch operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810."); operation {
+	case "GetItem":
+		response = map[string]any{}
+		if item := f.get(request.Key); item != nil {
+			response = map[string]any{"Item": item}
+		}
+	case "PutItem":
+		err = f.put(request)
+		response = map[string]any{}
+	case "Query":
+		response, err = f.query(request)
+	case "BatchWriteItem":
+		for _, writes := range request.RequestItems {
+			for _, write := range writes {
+				if write.PutRequest != nil {
+					f.store(write.PutRequest.Item)
+				}
+				if write.DeleteRequest != nil {
+					f.delete(write.DeleteRequest.Key)
+				}
+			}
+		}
+		response = map[string]any{"UnprocessedItems": map[string]any{}}
+	case "TransactWriteItems":
+		err = f.transact(request)
+		response = map[string]any{}
+	default:
+		err = fmt.Errorf("operation %q isn't supported by the fake", operation)
+	}
+	var cancelled fakeCancellation
+	switch {
+	case errors.Is(err, errConditionFailed):
+		fakeDynamoError(w, "ConditionalCheckFailedException", err.Error(), nil)
+	case errors.As(err, &cancelled):
+		fakeDynamoError(w, "TransactionCanceledException", "Transaction cancelled", cancelled)
+	case err != nil:
+		fakeDynamoError(w, "ValidationException", err.Error(), nil)
+	default:
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
+
+// fakeCancellation lists the cancellation reason of every item of a cancelled transaction
+type fakeCancellation []map[string]string
+
+func (c fakeCancellation) Error() string { return "transaction cancelled" }
+
+func fakeDynamoError(w http.ResponseWriter, errorType, message string, reasons fakeCancellation) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(http.StatusBadRequest)
+	body := map[string]any{"__type": "com.amazonaws.dynamodb.v20120810#" + errorType, "message": message}
+	if reasons != nil {
+		body["CancellationReasons"] = reasons
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeDynamo) get(key fakeItem) fakeItem {
+	return f.items[key.str("PK")][key.str("SK")]
+}
+
+func (f *fakeDynamo) store(item fakeItem) {
+	pk := item.str("PK")
+	if f.items[pk] == nil {
+		f.items[pk] = map[string]fakeItem{}
+	}
+	f.items[pk][item.str("SK")] = item
+}
+
+func (f *fakeDynamo) delete(key fakeItem) {
+	delete(f.items[key.str("PK")], key.str("SK"))
+}
+
+func (f *fakeDynamo) put(request fakeRequest) error {
+	if err := checkCondition(request.ConditionExpression, f.get(request.Item)); err != nil {
+		return err
+	}
+	f.store(request.Item)
+	return nil
+}
+
+// transact checks every condition before applying any write, as a transaction is all or nothing
+func (f *fakeDynamo) transact(request fakeRequest) error {
+	reasons := make(fakeCancellation, len(request.TransactItems))
+	failed := false
+	for i, item := range request.TransactItems {
+		reasons[i] = map[string]string{"Code": "None"}
+		var err error
+		switch {
+		case item.Put != nil:
+			err = checkCondition(item.Put.ConditionExpression, f.get(item.Put.Item))
+		case item.Delete != nil:
+			err = checkCondition(item.Delete.ConditionExpression, f.get(item.Delete.Key))
+		case item.Update != nil:
+			err = checkCondition(item.Update.ConditionExpression, f.get(item.Update.Key))
+		}
+		if errors.Is(err, errConditionFailed) {
+			reasons[i] = map[string]string{"Code": "ConditionalCheckFailed"}
+			failed = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if failed {
+		return reasons
+	}
+	for _, item := range request.TransactItems {
+		switch {
+		case item.Put != nil:
+			f.store(item.Put.Item)
+		case item.Delete != nil:
+			f.delete(item.Delete.Key)
+		case item.Update != nil:
+			if err := f.update(*item.Update); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var updateClause = regexp.MustCompile(`^(ADD|SET) (#?\w+) (?:= )?(:\w+)$`)
+
+// update applies update expressions made of "ADD name :value" and "SET name = :value" clauses
+func (f *fakeDynamo) update(request fakeRequest) error {
+	item := fakeItem{}
+	for name, value := range f.get(request.Key) {
+		item[name] = value
+	}
+	for name, value := range request.Key {
+		item[name] = value
+	}
+	expression := strings.ReplaceAll(request.UpdateExpression, " SET ", ", SET ")
+	for _, clause := range strings.Split(expression, ", ") {
+		match := updateClause.FindStringSubmatch(strings.TrimSpace(clause))
+		if match == nil {
+			return fmt.Errorf("update clause %q isn't supported by the fake", clause)
+		}
+		name := match[2]
+		if resolved, ok := request.ExpressionAttributeNames[name]; ok {
+			name = resolved
+		}
+		value := request.ExpressionAttributeValues[match[3]]
+		if match[1] == "ADD" {
+			current, _ := strconv.Atoi(item.num(name))
+			delta, _ := strconv.Atoi(fmt.Sprint(value["N"]))
+			value = map[string]any{"N": strconv.Itoa(current + delta)}
+		}
+		item[name] = value
+	}
+	f.store(item)
+	return nil
+}
+
+var existsCondition = regexp.MustCompile(`^attribute_(not_)?exists\((\w+)\)$`)
+
+// checkCondition evaluates conditions made of attribute_exists and attribute_not_exists joined by AND
+func checkCondition(expression string, existing fakeItem) error {
+	if expression == "" {
+		return nil
+	}
+	for _, clause := range strings.Split(expression, " AND ") {
+		match := existsCondition.FindStringSubmatch(clause)
+		if match == nil {
+			return fmt.Errorf("condition %q isn't supported by the fake", clause)
+		}
+		_, exists := existing[match[2]]
+		if exists == (match[1] == "not_") {
+			return errConditionFailed
+		}
+	}
+	return nil
+}
+
+var (
+	beginsWithCondition = regexp.MustCompile(`^begins_with\((\w+), (:\w+)\)$`)
+	betweenCondition    = regexp.MustCompile(`^(\w+) BETWEEN (:\w+) AND (:\w+)$`)
+	compareCondition    = regexp.MustCompile(`^(\w+) (<=|>=|<|>|=) (:\w+)$`)
+)
+
+// query answers key conditions on PK with an optional sort key condition, on the table or an LSI
+func (f *fakeDynamo) query(request fakeRequest) (any, error) {
+	keyCondition, sortCondition, _ := strings.Cut(request.KeyConditionExpression, " AND ")
+	if keyCondition != "PK = :pk" {
+		return nil, fmt.Errorf("key condition %q isn't supported by the fake", keyCondition)
+	}
+	sortKey := "SK"
+	if request.IndexName != "" {
+		sortKey = "SK_" + request.IndexName
+	}
+	values := request.ExpressionAttributeValues
+	var matches func(string) bool
+	switch {
+	case sortCondition == "":
+		matches = func(string) bool { return true }
+	case beginsWithCondition.MatchString(sortCondition):
+		match := beginsWithCondition.FindStringSubmatch(sortCondition)
+		matches = func(value string) bool { return strings.HasPrefix(value, values.str(match[2])) }
+	case betweenCondition.MatchString(sortCondition):
+		match := betweenCondition.FindStringSubmatch(sortCondition)
+		matches = func(value string) bool { return value >= values.str(match[2]) && value <= values.str(match[3]) }
+	case compareCondition.MatchString(sortCondition):
+		match := compareCondition.FindStringSubmatch(sortCondition)
+		operand := values.str(match[3])
+		matches = func(value string) bool {
+			switch match[2] {
+			case "<":
+				return value < operand
+			case "<=":
+				return value <= operand
+			case ">":
+				return value > operand
+			case ">=":
+				return value >= operand
+			}
+			return value == operand
+		}
+	default:
+		return nil, fmt.Errorf("sort key condition %q isn't supported by the fake", sortCondition)
+	}
+
+	var items []fakeItem
+	for _, item := range f.items[values.str(":pk")] {
+		// LSIs are sparse, items without the index sort key aren't in the index
+		if _, ok := item[sortKey]; ok && matches(item.str(sortKey)) {
+			items = append(items, item)
+		}
+	}
+	slices.SortFunc(items, func(a, b fakeItem) int { return strings.Compare(a.str(sortKey), b.str(sortKey)) })
+	if request.ScanIndexForward != nil && !*request.ScanIndexForward {
+		slices.Reverse(items)
+	}
+	if request.ExclusiveStartKey != nil {
+		start := slices.IndexFunc(items, func(item fakeItem) bool { return item.str("SK") == request.ExclusiveStartKey.str("SK") })
+		items = items[start+1:]
+	}
+	response := map[string]any{}
+	if request.Limit > 0 && len(items) > request.Limit {
+		items = items[:request.Limit]
+		last := items[len(items)-1]
+		lastKey := fakeItem{"PK": last["PK"], "SK": last["SK"]}
+		if sortKey != "SK" {
+			lastKey[sortKey] = last[sortKey]
+		}
+		response["LastEvaluatedKey"] = lastKey
+	}
+	response["Count"] = len(items)
+	if request.Select != "COUNT" {
+		response["Items"] = items
+	}
+	return response, nil
+}
+
+func (item fakeItem) str(name string) string {
+	value, _ := item[name]["S"].(string)
+	return value
+}
+
+func (item fakeItem) num(name string) string {
+	value, _ := item[name]["N"].(string)
+	return value
+}
+
+// partition returns the sort keys of the items of a partition, sorted
+func (f *fakeDynamo) partition(pk string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for sk := range f.items[pk] {
+		keys = append(keys, sk)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// counter returns the maintained counter of a post partition, -1 when it doesn't exist
+func (f *fakeDynamo) counter(partition string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item, ok := f.items["COUNTER"][partition]
+	if !ok {
+		return -1
+	}
+	count, _ := strconv.Atoi(item.num("count"))
+	return count
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Settings read from the environment fall back to their default when unset. Invalid values are logged and
+// ignored, so a typo in the deployment degrades to the default instead of failing the cold start
+
+// envInt reads an integer of at least minimum
+func envInt(name string, fallback, minimum int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < minimum {
+		slog.Warn("Ignoring invalid "+name, "Value", value)
+		return fallback
+	}
+	return parsed
+}
+
+// envDuration reads a positive duration e.g. "1m"
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		slog.Warn("Ignoring invalid "+name, "Value", value)
+		return fallback
+	}
+	return parsed
+}
+
+// envDate reads a YYYY-MM-DD date, as midnight UTC
+func envDate(name string, fallback time.Time) time.Time {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		slog.Warn("Ignoring invalid "+name, "Value", value)
+		return fallback
+	}
+	return parsed
+}
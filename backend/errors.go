@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// NotFoundError is returned when the requested resource doesn't exist
+type NotFoundError struct {
+	Resource string
+	Key      string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %q not found", e.Resource, e.Key)
+}
+
+// ConflictError is returned when a write loses a race against a concurrent write
+type ConflictError struct {
+	Message string
+	Err     error
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned when a request is malformed or breaks validation rules
+type ValidationError struct {
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func NewValidationError(fields []FieldError) *ValidationError {
+	return &ValidationError{Message: "Validation failed", Fields: fields}
+}
+
+// UnauthorizedError is returned when a request lacks valid credentials
+type UnauthorizedError struct {
+	Message string
+}
+
+func (e *UnauthorizedError) Error() string {
+	return e.Message
+}
+
+// UpstreamError is returned when a dependency such as DynamoDB or CloudFront fails
+type UpstreamError struct {
+	Service string
+	Err     error
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Service, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// NewBindingError turns a gin binding error into a ValidationError listing the offending fields
+func NewBindingError(err error) *ValidationError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return &ValidationError{Message: "Invalid request payload", Err: err}
+	}
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		// drop the struct name heading the namespace e.g. "HardSyncRequest.posts[0].slug"
+		_, field, _ := strings.Cut(fieldError.Namespace(), ".")
+		fields = append(fields, FieldError{Field: field, Message: bindingMessage(fieldError)})
+	}
+	return &ValidationError{Message: "Invalid request payload", Fields: fields, Err: err}
+}
+
+// bindingMessage phrases a failed binding rule the way ValidatePost phrases its own
+func bindingMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if fieldError.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fieldError.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fieldError.Param())
+	case "max":
+		if fieldError.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fieldError.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fieldError.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(fieldError.Param(), " ", ", "))
+	case "datetime":
+		return fmt.Sprintf("must be a date formatted as %s", fieldError.Param())
+	default:
+		return fmt.Sprintf("failed on the '%s' rule", fieldError.Tag())
+	}
+}
+
+// NewRestError maps an error returned by a handler to the problem details sent to the client,
+// unknown errors become a generic 500 so internals never leak
+func NewRestError(err error) *RestError {
+	var notFound *NotFoundError
+	var conflict *ConflictError
+	var validation *ValidationError
+	var unauthorized *UnauthorizedError
+	var upstream *UpstreamError
+	var tooManyRequests *TooManyRequestsError
+	var operationError *smithy.OperationError
+	switch {
+	case errors.As(err, &validation):
+		problem := newProblem(http.StatusBadRequest, validation.Message)
+		problem.Errors = validation.Fields
+		return problem
+	case errors.As(err, &notFound):
+		return newProblem(http.StatusNotFound, notFound.Error())
+	case errors.As(err, &conflict):
+		return newProblem(http.StatusConflict, conflict.Message)
+	case errors.As(err, &unauthorized):
+		return newProblem(http.StatusUnauthorized, unauthorized.Message)
+	case errors.As(err, &tooManyRequests):
+		return newProblem(http.StatusTooManyRequests, "Too many requests, retry later")
+	case errors.As(err, &upstream):
+		return newProblem(http.StatusBadGateway, fmt.Sprintf("%s is unavailable", upstream.Service))
+	case errors.As(err, &operationError):
+		if status, unavailable := outageStatus(err); unavailable {
+			return newProblem(status, fmt.Sprintf("%s is unavailable", operationError.Service()))
+		}
+		return newProblem(http.StatusInternalServerError, "Unexpected error")
+	default:
+		return newProblem(http.StatusInternalServerError, "Unexpected error")
+	}
+}
+
+// outageStatus tells whether an AWS error is an outage of the service rather than a bug in our request,
+// throttling answers 503 while timeouts and server faults answer 502
+func outageStatus(err error) (int, bool) {
+	if retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+		return http.StatusServiceUnavailable, true
+	}
+	if errors.Is(err, context.DeadlineExceeded) || retry.IsErrorTimeouts(retry.DefaultTimeouts).IsErrorTimeout(err) == aws.TrueTernary {
+		return http.StatusBadGateway, true
+	}
+	var responseError *smithyhttp.ResponseError
+	if errors.As(err, &responseError) && responseError.HTTPStatusCode() >= http.StatusInternalServerError {
+		return http.StatusBadGateway, true
+	}
+	var apiError smithy.APIError
+	if errors.As(err, &apiError) && apiError.ErrorFault() == smithy.FaultServer {
+		return http.StatusBadGateway, true
+	}
+	return 0, false
+}
+
+// abortWithError records the error for ProblemMiddleware to render and stops the handler chain
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
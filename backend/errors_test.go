@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestNewRestErrorSeparatesOutagesFromBugs(t *testing.T) {
+	dynamoError := func(status int, err error) error {
+		return fmt.Errorf("upsert: %w", &smithy.OperationError{
+			ServiceID: "DynamoDB", OperationName: "TransactWriteItems",
+			Err: &smithyhttp.ResponseError{Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}}, Err: err},
+		})
+	}
+	cases := map[string]struct {
+		err  error
+		want int
+	}{
+		"validation":          {dynamoError(400, &smithy.GenericAPIError{Code: "ValidationException", Fault: smithy.FaultClient}), 500},
+		"own condition":       {dynamoError(400, &types.TransactionCanceledException{}), 500},
+		"throttled":           {dynamoError(400, &types.ProvisionedThroughputExceededException{}), 503},
+		"internal error":      {dynamoError(500, &types.InternalServerError{}), 502},
+		"unavailable":         {dynamoError(503, &smithy.GenericAPIError{Code: "ServiceUnavailable"}), 502},
+		"deadline exceeded":   {dynamoError(0, context.DeadlineExceeded), 502},
+		"explicitly upstream": {&UpstreamError{Service: "Google certs", Err: fmt.Errorf("dial tcp: connection refused")}, 502},
+	}
+	for name, tc := range cases {
+		if got := NewRestError(tc.err).Status; got != tc.want {
+			t.Errorf("%s: expected %d, got %d", name, tc.want, got)
+		}
+	}
+}
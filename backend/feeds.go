@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	feedTitle = "Cloudificando"
+	// feedSize is the number of latest posts a feed carries
+	feedSize = 20
+)
+
+// feedFormat is a syndication format a feed is rendered in
+type feedFormat struct {
+	ContentType string
+	Render      func(feed *Feed) ([]byte, error)
+}
+
+const (
+	rssContentType      = "application/rss+xml"
+	atomContentType     = "application/atom+xml"
+	jsonFeedContentType = "application/feed+json"
+)
+
+var (
+	rssFormat      = feedFormat{ContentType: rssContentType, Render: renderRSS}
+	atomFormat     = feedFormat{ContentType: atomContentType, Render: renderAtom}
+	jsonFeedFormat = feedFormat{ContentType: jsonFeedContentType, Render: renderJSONFeed}
+)
+
+// Feed is the format independent content of a feed, the latest posts newest first
+type Feed struct {
+	Title   string
+	Link    string // page of the site listing the posts of the feed
+	SelfURL string
+	Updated time.Time // creation date of the newest post, zero when the feed is empty
+	Posts   []Post
+}
+
+// FeedHandler serves the latest posts, of the tag path parameter when there is one, in the given format.
+// The ETag is derived from the rendered feed so edits to existing posts are picked up, Last-Modified from the newest post
+func (bc *BlogController) FeedHandler(format feedFormat) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		feed, err := bc.feed(ctx, c.Param("tag"))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		feed.SelfURL = requestOrigin(c) + c.Request.URL.Path
+		body, err := format.Render(feed)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		writeDocument(c, format.ContentType, body, feed.Updated)
+	}
+}
+
+// writeDocument writes a generated document with a Last-Modified unless lastModified is zero,
+// CompressionMiddleware derives its ETag and answers conditional requests
+func writeDocument(c *gin.Context, contentType string, body []byte, lastModified time.Time) {
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	c.Data(http.StatusOK, contentType+"; charset=utf-8", body)
+}
+
+// feed lists the latest posts, of a tag when tag isn't empty
+func (bc *BlogController) feed(ctx context.Context, tag string) (*Feed, error) {
+	feed := &Feed{Title: feedTitle, Link: siteURL() + "/posts"}
+	if tag != "" {
+		tag = normalizeQueryTag(tag)
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, NewValidationError([]FieldError{{Field: "tag", Message: fmt.Sprintf("must be at most %d characters", maxTagLength)}})
+		}
+		feed.Title = feedTitle + " - " + tag
+		feed.Link += "?tag=" + url.QueryEscape(tag)
+	}
+	page, err := bc.repository.GetPosts(ctx, ListPostsQuery{Limit: feedSize, Sort: "desc", Tag: tag})
+	if err != nil {
+		return nil, err
+	}
+	if tag != "" && len(page.Items) == 0 {
+		return nil, &NotFoundError{Resource: "tag", Key: tag}
+	}
+	feed.Posts = page.Items
+	if len(feed.Posts) > 0 {
+		feed.Updated, _ = parsePostDate(feed.Posts[0].CreatedAt)
+	}
+	return feed, nil
+}
+
+// siteURL is the origin of the frontend posts link to, read from SITE_URL
+func siteURL() string {
+	if site := os.Getenv("SITE_URL"); site != "" {
+		return strings.TrimSuffix(site, "/")
+	}
+	return "https://" + os.Getenv("PROD_DOMAIN")
+}
+
+// requestOrigin is the public origin of the API, the request host is used when PROD_DOMAIN isn't set e.g. in dev
+func requestOrigin(c *gin.Context) string {
+	if domain := os.Getenv("PROD_DOMAIN"); domain != "" {
+		return "https://" + domain
+	}
+	return "http://" + c.Request.Host
+}
+
+func postURL(post *Post) string {
+	return siteURL() + "/posts/" + post.Slug
+}
+
+func postTime(post *Post) time.Time {
+	created, _ := parsePostDate(post.CreatedAt)
+	return created
+}
+
+type rssDocument struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	AtomSpace string     `xml:"xmlns:atom,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func renderRSS(feed *Feed) ([]byte, error) {
+	document := rssDocument{
+		Version:   "2.0",
+		AtomSpace: "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       feed.Title,
+			Link:        feed.Link,
+			Description: "Latest posts of " + feed.Title,
+			Self:        atomLink{Href: feed.SelfURL, Rel: "self", Type: rssContentType},
+		},
+	}
+	if !feed.Updated.IsZero() {
+		document.Channel.LastBuildDate = feed.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for i := range feed.Posts {
+		post := &feed.Posts[i]
+		document.Channel.Items = append(document.Channel.Items, rssItem{
+			Title:       post.Title,
+			Link:        postURL(post),
+			GUID:        rssGUID{IsPermaLink: true, Value: postURL(post)},
+			PubDate:     postTime(post).UTC().Format(time.RFC1123Z),
+			Description: post.Description,
+			Categories:  post.Tags,
+		})
+	}
+	return marshalXML(document)
+}
+
+type atomDocument struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Summary    string         `xml:"summary"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+func renderAtom(feed *Feed) ([]byte, error) {
+	document := atomDocument{
+		Title:   feed.Title,
+		ID:      feed.SelfURL,
+		Updated: feed.Updated.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: feedTitle},
+		Links: []atomLink{
+			{Href: feed.SelfURL, Rel: "self", Type: atomContentType},
+			{Href: feed.Link, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	for i := range feed.Posts {
+		post := &feed.Posts[i]
+		entry := atomEntry{
+			Title:     post.Title,
+			ID:        postURL(post),
+			Link:      atomLink{Href: postURL(post), Rel: "alternate", Type: "text/html"},
+			Published: postTime(post).UTC().Format(time.RFC3339),
+			Updated:   postTime(post).UTC().Format(time.RFC3339),
+			Summary:   post.Description,
+		}
+		for _, tag := range post.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		document.Entries = append(document.Entries, entry)
+	}
+	return marshalXML(document)
+}
+
+func marshalXML(document any) ([]byte, error) {
+	body, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// JSONFeed is a JSON Feed 1.1 document, see https://www.jsonfeed.org/version/1.1/
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	Summary       string   `json:"summary,omitempty"`
+	DatePublished string   `json:"date_published"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+func renderJSONFeed(feed *Feed) ([]byte, error) {
+	document := JSONFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: feed.Link,
+		FeedURL:     feed.SelfURL,
+		Items:       []JSONFeedItem{},
+	}
+	for i := range feed.Posts {
+		post := &feed.Posts[i]
+		document.Items = append(document.Items, JSONFeedItem{
+			ID:            postURL(post),
+			URL:           postURL(post),
+			Title:         post.Title,
+			Summary:       post.Description,
+			DatePublished: postTime(post).UTC().Format(time.RFC3339),
+			Tags:          post.Tags,
+		})
+	}
+	return json.Marshal(document)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testFeed() *Feed {
+	return &Feed{
+		Title:   feedTitle,
+		Link:    "https://example.com/posts",
+		SelfURL: "https://api.example.com/blog/feed.xml",
+		Updated: time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC),
+		Posts: []Post{
+			{Slug: "newer", Title: "Newer & better", Description: "<b>escaped</b>", CreatedAt: "2026-03-02", Tags: []string{"go"}},
+			{Slug: "older", Title: "Older", CreatedAt: "2026-01-15T10:00:00Z"},
+		},
+	}
+}
+
+func TestFeedsRender(t *testing.T) {
+	t.Setenv("SITE_URL", "https://example.com/")
+
+	body, err := renderRSS(testFeed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rss rssDocument
+	if err := xml.Unmarshal(body, &rss); err != nil {
+		t.Fatal(err)
+	}
+	item := rss.Channel.Items[0]
+	if len(rss.Channel.Items) != 2 || item.Link != "https://example.com/posts/newer" || item.Description != "<b>escaped</b>" {
+		t.Errorf("unexpected rss item %+v", item)
+	}
+	if item.PubDate != "Mon, 02 Mar 2026 00:00:00 +0000" {
+		t.Errorf("unexpected pubDate %q", item.PubDate)
+	}
+
+	body, err = renderAtom(testFeed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var atom atomDocument
+	if err := xml.Unmarshal(body, &atom); err != nil {
+		t.Fatal(err)
+	}
+	if atom.Updated != "2026-03-02T00:00:00Z" || atom.Entries[1].Published != "2026-01-15T10:00:00Z" {
+		t.Errorf("unexpected atom dates %q and %q", atom.Updated, atom.Entries[1].Published)
+	}
+
+	body, err = renderJSONFeed(&Feed{Title: feedTitle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed map[string]any
+	if err := json.Unmarshal(body, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if items, ok := feed["items"].([]any); !ok || len(items) != 0 {
+		t.Errorf("empty feeds should have an empty items array, got %v", feed["items"])
+	}
+}
+
+func TestFeedConditionalRequests(t *testing.T) {
+	updated := time.Date(2026, time.March, 2, 12, 30, 0, 0, time.UTC)
+	cases := []struct {
+		header, value string
+		want          bool
+	}{
+		{"If-None-Match", `"abc"`, true},
+		{"If-None-Match", `"other", W/"abc"`, true},
+		{"If-None-Match", `"other"`, false},
+		{"If-Modified-Since", "Mon, 02 Mar 2026 12:30:00 GMT", true},
+		{"If-Modified-Since", "Mon, 02 Mar 2026 12:29:59 GMT", false},
+	}
+	for _, tc := range cases {
+		request := httptest.NewRequest("GET", "/blog/feed.xml", nil)
+		request.Header.Set(tc.header, tc.value)
+		if got := notModified(request, `"abc"`, updated); got != tc.want {
+			t.Errorf("%s: %s, expected %v", tc.header, tc.value, tc.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: cloudificando/blog/v1/blog.proto
+
+package blogv1connect
+
+import (
+	v1 "cloudificando/gen/cloudificando/blog/v1"
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// BlogServiceName is the fully-qualified name of the BlogService service.
+	BlogServiceName = "cloudificando.blog.v1.BlogService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// BlogServiceListPostsProcedure is the fully-qualified name of the BlogService's ListPosts RPC.
+	BlogServiceListPostsProcedure = "/cloudificando.blog.v1.BlogService/ListPosts"
+	// BlogServiceGetPostProcedure is the fully-qualified name of the BlogService's GetPost RPC.
+	BlogServiceGetPostProcedure = "/cloudificando.blog.v1.BlogService/GetPost"
+	// BlogServiceListTagsProcedure is the fully-qualified name of the BlogService's ListTags RPC.
+	BlogServiceListTagsProcedure = "/cloudificando.blog.v1.BlogService/ListTags"
+	// BlogServiceUpsertPostProcedure is the fully-qualified name of the BlogService's UpsertPost RPC.
+	BlogServiceUpsertPostProcedure = "/cloudificando.blog.v1.BlogService/UpsertPost"
+	// BlogServiceDeletePostProcedure is the fully-qualified name of the BlogService's DeletePost RPC.
+	BlogServiceDeletePostProcedure = "/cloudificando.blog.v1.BlogService/DeletePost"
+	// BlogServiceSyncPostsProcedure is the fully-qualified name of the BlogService's SyncPosts RPC.
+	BlogServiceSyncPostsProcedure = "/cloudificando.blog.v1.BlogService/SyncPosts"
+)
+
+// BlogServiceClient is a client for the cloudificando.blog.v1.BlogService service.
+type BlogServiceClient interface {
+	// ListPosts lists posts, newest first by default, optionally filtered by tag and creation date
+	ListPosts(context.Context, *connect.Request[v1.ListPostsRequest]) (*connect.Response[v1.ListPostsResponse], error)
+	// GetPost gets a post along with its body
+	GetPost(context.Context, *connect.Request[v1.GetPostRequest]) (*connect.Response[v1.GetPostResponse], error)
+	// ListTags lists tags with their post counts
+	ListTags(context.Context, *connect.Request[v1.ListTagsRequest]) (*connect.Response[v1.ListTagsResponse], error)
+	// UpsertPost creates or updates a post
+	UpsertPost(context.Context, *connect.Request[v1.UpsertPostRequest]) (*connect.Response[v1.UpsertPostResponse], error)
+	// DeletePost deletes a post
+	DeletePost(context.Context, *connect.Request[v1.DeletePostRequest]) (*connect.Response[v1.DeletePostResponse], error)
+	// SyncPosts upserts every post and rebuilds counters and related posts
+	SyncPosts(context.Context, *connect.Request[v1.SyncPostsRequest]) (*connect.Response[v1.SyncPostsResponse], error)
+}
+
+// NewBlogServiceClient constructs a client for the cloudificando.blog.v1.BlogService service. By
+// default, it uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses,
+// and sends uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the
+// connect.WithGRPC() or connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewBlogServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) BlogServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	blogServiceMethods := v1.File_cloudificando_blog_v1_blog_proto.Services().ByName("BlogService").Methods()
+	return &blogServiceClient{
+		listPosts: connect.NewClient[v1.ListPostsRequest, v1.ListPostsResponse](
+			httpClient,
+			baseURL+BlogServiceListPostsProcedure,
+			connect.WithSchema(blogServiceMethods.ByName("ListPosts")),
+			connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+			connect.WithClientOptions(opts...),
+		),
+		getPost: connect.NewClient[v1.GetPostRequest, v1.GetPostResponse](
+			httpClient,
+			baseURL+BlogServiceGetPostProcedure,
+			connect.WithSchema(blogServiceMethods.ByName("GetPost")),
+			connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+			connect.WithClientOptions(opts...),
+		),
+		listTags: connect.NewClient[v1.ListTagsRequest, v1.ListTagsResponse](
+			httpClient,
+			baseURL+BlogServiceListTagsProcedure,
+			connect.WithSchema(blogServiceMethods.ByName("ListTags")),
+			connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+			connect.WithClientOptions(opts...),
+		),
+		upsertPost: connect.NewClient[v1.UpsertPostRequest, v1.UpsertPostResponse](
+			httpClient,
+			baseURL+BlogServiceUpsertPostProcedure,
+			connect.WithSchema(blogServiceMethods.ByName("UpsertPost")),
+			connect.WithIdempotency(connect.IdempotencyIdempotent),
+			connect.WithClientOptions(opts...),
+		),
+		deletePost: connect.NewClient[v1.DeletePostRequest, v1.DeletePostResponse](
+			httpClient,
+			baseURL+BlogServiceDeletePostProcedure,
+			connect.WithSchema(blogServiceMethods.ByName("DeletePost")),
+			connect.WithIdempotency(connect.IdempotencyIdempotent),
+			connect.WithClientOptions(opts...),
+		),
+		syncPosts: connect.NewClient[v1.SyncPostsRequest, v1.SyncPostsResponse](
+			httpClient,
+			baseURL+BlogServiceSyncPostsProcedure,
+			connect.WithSchema(blogServiceMethods.ByName("SyncPosts")),
+			connect.WithIdempotency(connect.IdempotencyIdempotent),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// blogServiceClient implements BlogServiceClient.
+type blogServiceClient struct {
+	listPosts  *connect.Client[v1.ListPostsRequest, v1.ListPostsResponse]
+	getPost    *connect.Client[v1.GetPostRequest, v1.GetPostResponse]
+	listTags   *connect.Client[v1.ListTagsRequest, v1.ListTagsResponse]
+	upsertPost *connect.Client[v1.UpsertPostRequest, v1.UpsertPostResponse]
+	deletePost *connect.Client[v1.DeletePostRequest, v1.DeletePostResponse]
+	syncPosts  *connect.Client[v1.SyncPostsRequest, v1.SyncPostsResponse]
+}
+
+// ListPosts calls cloudificando.blog.v1.BlogService.ListPosts.
+func (c *blogServiceClient) ListPosts(ctx context.Context, req *connect.Request[v1.ListPostsRequest]) (*connect.Response[v1.ListPostsResponse], error) {
+	return c.listPosts.CallUnary(ctx, req)
+}
+
+// GetPost calls cloudificando.blog.v1.BlogService.GetPost.
+func (c *blogServiceClient) GetPost(ctx context.Context, req *connect.Request[v1.GetPostRequest]) (*connect.Response[v1.GetPostResponse], error) {
+	return c.getPost.CallUnary(ctx, req)
+}
+
+// ListTags calls cloudificando.blog.v1.BlogService.ListTags.
+func (c *blogServiceClient) ListTags(ctx context.Context, req *connect.Request[v1.ListTagsRequest]) (*connect.Response[v1.ListTagsResponse], error) {
+	return c.listTags.CallUnary(ctx, req)
+}
+
+// UpsertPost calls cloudificando.blog.v1.BlogService.UpsertPost.
+func (c *blogServiceClient) UpsertPost(ctx context.Context, req *connect.Request[v1.UpsertPostRequest]) (*connect.Response[v1.UpsertPostResponse], error) {
+	return c.upsertPost.CallUnary(ctx, req)
+}
+
+// DeletePost calls cloudificando.blog.v1.BlogService.DeletePost.
+func (c *blogServiceClient) DeletePost(ctx context.Context, req *connect.Request[v1.DeletePostRequest]) (*connect.Response[v1.DeletePostResponse], error) {
+	return c.deletePost.CallUnary(ctx, req)
+}
+
+// SyncPosts calls cloudificando.blog.v1.BlogService.SyncPosts.
+func (c *blogServiceClient) SyncPosts(ctx context.Context, req *connect.Request[v1.SyncPostsRequest]) (*connect.Response[v1.SyncPostsResponse], error) {
+	return c.syncPosts.CallUnary(ctx, req)
+}
+
+// BlogServiceHandler is an implementation of the cloudificando.blog.v1.BlogService service.
+type BlogServiceHandler interface {
+	// ListPosts lists posts, newest first by default, optionally filtered by tag and creation date
+	ListPosts(context.Context, *connect.Request[v1.ListPostsRequest]) (*connect.Response[v1.ListPostsResponse], error)
+	// GetPost gets a post along with its body
+	GetPost(context.Context, *connect.Request[v1.GetPostRequest]) (*connect.Response[v1.GetPostResponse], error)
+	// ListTags lists tags with their post counts
+	ListTags(context.Context, *connect.Request[v1.ListTagsRequest]) (*connect.Response[v1.ListTagsResponse], error)
+	// UpsertPost creates or updates a post
+	UpsertPost(context.Context, *connect.Request[v1.UpsertPostRequest]) (*connect.Response[v1.UpsertPostResponse], error)
+	// DeletePost deletes a post
+	DeletePost(context.Context, *connect.Request[v1.DeletePostRequest]) (*connect.Response[v1.DeletePostResponse], error)
+	// SyncPosts upserts every post and rebuilds counters and related posts
+	SyncPosts(context.Context, *connect.Request[v1.SyncPostsRequest]) (*connect.Response[v1.SyncPostsResponse], error)
+}
+
+// NewBlogServiceHandler builds an HTTP handler from the service implementation. It returns the path
+// on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewBlogServiceHandler(svc BlogServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	blogServiceMethods := v1.File_cloudificando_blog_v1_blog_proto.Services().ByName("BlogService").Methods()
+	blogServiceListPostsHandler := connect.NewUnaryHandler(
+		BlogServiceListPostsProcedure,
+		svc.ListPosts,
+		connect.WithSchema(blogServiceMethods.ByName("ListPosts")),
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+		connect.WithHandlerOptions(opts...),
+	)
+	blogServiceGetPostHandler := connect.NewUnaryHandler(
+		BlogServiceGetPostProcedure,
+		svc.GetPost,
+		connect.WithSchema(blogServiceMethods.ByName("GetPost")),
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+		connect.WithHandlerOptions(opts...),
+	)
+	blogServiceListTagsHandler := connect.NewUnaryHandler(
+		BlogServiceListTagsProcedure,
+		svc.ListTags,
+		connect.WithSchema(blogServiceMethods.ByName("ListTags")),
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+		connect.WithHandlerOptions(opts...),
+	)
+	blogServiceUpsertPostHandler := connect.NewUnaryHandler(
+		BlogServiceUpsertPostProcedure,
+		svc.UpsertPost,
+		connect.WithSchema(blogServiceMethods.ByName("UpsertPost")),
+		connect.WithIdempotency(connect.IdempotencyIdempotent),
+		connect.WithHandlerOptions(opts...),
+	)
+	blogServiceDeletePostHandler := connect.NewUnaryHandler(
+		BlogServiceDeletePostProcedure,
+		svc.DeletePost,
+		connect.WithSchema(blogServiceMethods.ByName("DeletePost")),
+		connect.WithIdempotency(connect.IdempotencyIdempotent),
+		connect.WithHandlerOptions(opts...),
+	)
+	blogServiceSyncPostsHandler := connect.NewUnaryHandler(
+		BlogServiceSyncPostsProcedure,
+		svc.SyncPosts,
+		connect.WithSchema(blogServiceMethods.ByName("SyncPosts")),
+		connect.WithIdempotency(connect.IdempotencyIdempotent),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/cloudificando.blog.v1.BlogService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case BlogServiceListPostsProcedure:
+			blogServiceListPostsHandler.ServeHTTP(w, r)
+		case BlogServiceGetPostProcedure:
+			blogServiceGetPostHandler.ServeHTTP(w, r)
+		case BlogServiceListTagsProcedure:
+			blogServiceListTagsHandler.ServeHTTP(w, r)
+		case BlogServiceUpsertPostProcedure:
+			blogServiceUpsertPostHandler.ServeHTTP(w, r)
+		case BlogServiceDeletePostProcedure:
+			blogServiceDeletePostHandler.ServeHTTP(w, r)
+		case BlogServiceSyncPostsProcedure:
+			blogServiceSyncPostsHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedBlogServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedBlogServiceHandler struct{}
+
+func (UnimplementedBlogServiceHandler) ListPosts(context.Context, *connect.Request[v1.ListPostsRequest]) (*connect.Response[v1.ListPostsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("cloudificando.blog.v1.BlogService.ListPosts is not implemented"))
+}
+
+func (UnimplementedBlogServiceHandler) GetPost(context.Context, *connect.Request[v1.GetPostRequest]) (*connect.Response[v1.GetPostResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("cloudificando.blog.v1.BlogService.GetPost is not implemented"))
+}
+
+func (UnimplementedBlogServiceHandler) ListTags(context.Context, *connect.Request[v1.ListTagsRequest]) (*connect.Response[v1.ListTagsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("cloudificando.blog.v1.BlogService.ListTags is not implemented"))
+}
+
+func (UnimplementedBlogServiceHandler) UpsertPost(context.Context, *connect.Request[v1.UpsertPostRequest]) (*connect.Response[v1.UpsertPostResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("cloudificando.blog.v1.BlogService.UpsertPost is not implemented"))
+}
+
+func (UnimplementedBlogServiceHandler) DeletePost(context.Context, *connect.Request[v1.DeletePostRequest]) (*connect.Response[v1.DeletePostResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("cloudificando.blog.v1.BlogService.DeletePost is not implemented"))
+}
+
+func (UnimplementedBlogServiceHandler) SyncPosts(context.Context, *connect.Request[v1.SyncPostsRequest]) (*connect.Response[v1.SyncPostsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("cloudificando.blog.v1.BlogService.SyncPosts is not implemented"))
+}
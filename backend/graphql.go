@@ -0,0 +1,655 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+const (
+	defaultGraphQLMaxComplexity = 300
+	defaultGraphQLMaxDepth      = 8
+	// graphQLTagsEstimate is the number of tags assumed when costing selections under Query.tags
+	graphQLTagsEstimate = 50
+)
+
+// graphQLFieldCosts are the costs of fields that read more than the item they belong to, other fields cost 1
+var graphQLFieldCosts = map[string]int{
+	"body":       10, // reassembled from BODY# chunks
+	"totalCount": 2,
+	"neighbours": 4,
+	"related":    2,
+	"toc":        2, // read from the POST item on listings
+}
+
+// GraphQLRequest is the body of a GraphQL POST request, query may be left out in favor
+// of a persisted query hash in extensions
+type GraphQLRequest struct {
+	Query         string         `json:"query,omitempty"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	Extensions    map[string]any `json:"extensions,omitempty"`
+}
+
+// GraphQLQuery are the query parameters of a GraphQL GET request, variables and extensions are JSON encoded
+type GraphQLQuery struct {
+	Query         string `form:"query"`
+	OperationName string `form:"operationName"`
+	Variables     string `form:"variables"`
+	Extensions    string `form:"extensions"`
+}
+
+// GraphQLResponse is the body of every GraphQL response
+type GraphQLResponse struct {
+	Data   any            `json:"data,omitempty"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+type GraphQLError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// GraphQLAPI serves the blog read model over GraphQL, queries are costed before they run
+type GraphQLAPI struct {
+	schema        graphql.Schema
+	repository    *BlogRepository
+	limits        RouteLimits
+	persisted     *PersistedQueries
+	maxComplexity int
+	maxDepth      int
+}
+
+// NewGraphQLAPI reads GRAPHQL_MAX_COMPLEXITY and GRAPHQL_MAX_DEPTH, page sizes are capped
+// like the posts listing of the REST API
+func NewGraphQLAPI(repository *BlogRepository, limits RouteLimits) *GraphQLAPI {
+	api := &GraphQLAPI{
+		repository:    repository,
+		limits:        limits,
+		persisted:     NewPersistedQueriesFromEnv(repository),
+		maxComplexity: envInt("GRAPHQL_MAX_COMPLEXITY", defaultGraphQLMaxComplexity, 1),
+		maxDepth:      envInt("GRAPHQL_MAX_DEPTH", defaultGraphQLMaxDepth, 1),
+	}
+	schema, err := api.newSchema()
+	if err != nil {
+		// the schema is static, failing to build it is a programming error
+		panic(err)
+	}
+	api.schema = schema
+	return api
+}
+
+// postConnection is the page of posts behind a PostConnection
+type postConnection struct {
+	query ListPostsQuery
+	page  *ListPosts
+}
+
+func (api *GraphQLAPI) newSchema() (graphql.Schema, error) {
+	sortOrder := graphql.NewEnum(graphql.EnumConfig{
+		Name: "SortOrder",
+		Values: graphql.EnumValueConfigMap{
+			"ASC":  {Value: SortAsc},
+			"DESC": {Value: SortDesc},
+		},
+	})
+	var tocItem *graphql.Object
+	tocItem = graphql.NewObject(graphql.ObjectConfig{
+		Name: "TocItem",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"title": {Type: graphql.NewNonNull(graphql.String)},
+				"url":   {Type: graphql.NewNonNull(graphql.String)},
+				"items": {
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tocItem))),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return nonNilSlice(p.Source.(TocItem).Items), nil
+					},
+				},
+			}
+		}),
+	})
+
+	var post *graphql.Object
+	pageArgs := graphql.FieldConfigArgument{
+		"first":  {Type: graphql.Int, DefaultValue: defaultMaxLimit},
+		"after":  {Type: graphql.String, Description: "endCursor of the previous page"},
+		"before": {Type: graphql.String, Description: "startCursor of the next page"},
+		"sort":   {Type: sortOrder, DefaultValue: SortDesc},
+		"from":   {Type: graphql.String, Description: "YYYY-MM-DD, inclusive"},
+		"to":     {Type: graphql.String, Description: "YYYY-MM-DD, inclusive"},
+	}
+	post = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"slug":        {Type: graphql.NewNonNull(graphql.String)},
+				"title":       {Type: graphql.NewNonNull(graphql.String)},
+				"description": {Type: graphql.NewNonNull(graphql.String)},
+				"tags":        {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String)))},
+				"createdAt":   {Type: graphql.NewNonNull(graphql.String)},
+				"series":      {Type: graphql.String, Resolve: resolveOptionalString(func(p Post) string { return p.Series })},
+				"seriesOrder": {Type: graphql.Int, Resolve: resolveOptionalInt(func(p Post) int { return p.SeriesOrder })},
+				"wordCount":   {Type: graphql.NewNonNull(graphql.Int)},
+				"readingTime": {Type: graphql.NewNonNull(graphql.Int), Description: "minutes"},
+				"toc": {
+					Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tocItem))),
+					Resolve: api.resolveToc,
+				},
+				"body": {
+					Type:    graphql.NewNonNull(graphql.String),
+					Resolve: api.resolveBody,
+				},
+				"related": {
+					Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(post))),
+					Resolve: api.resolveRelated,
+				},
+				"neighbours": {
+					Type: graphql.NewNonNull(graphql.NewObject(graphql.ObjectConfig{
+						Name: "PostNeighbours",
+						Fields: graphql.Fields{
+							"previous": {Type: post, Resolve: resolveNeighbour(func(n *PostNeighbours) *Post { return n.Previous })},
+							"next":     {Type: post, Resolve: resolveNeighbour(func(n *PostNeighbours) *Post { return n.Next })},
+						},
+					})),
+					Args:    graphql.FieldConfigArgument{"tag": {Type: graphql.String}},
+					Resolve: api.resolveNeighbours,
+				},
+			}
+		}),
+	})
+	pageInfo := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage":     {Type: graphql.NewNonNull(graphql.Boolean), Resolve: resolvePage(func(page *ListPosts) any { return page.NextCursor != "" })},
+			"hasPreviousPage": {Type: graphql.NewNonNull(graphql.Boolean), Resolve: resolvePage(func(page *ListPosts) any { return page.PrevCursor != "" })},
+			"startCursor":     {Type: graphql.String, Resolve: resolvePage(func(page *ListPosts) any { return optionalString(page.PrevCursor) })},
+			"endCursor":       {Type: graphql.String, Resolve: resolvePage(func(page *ListPosts) any { return optionalString(page.NextCursor) })},
+		},
+	})
+	postEdge := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PostEdge",
+		Fields: graphql.Fields{
+			"node": {Type: graphql.NewNonNull(post), Resolve: func(p graphql.ResolveParams) (any, error) { return p.Source, nil }},
+		},
+	})
+	postConnectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PostConnection",
+		Fields: graphql.Fields{
+			"nodes":      {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(post))), Resolve: resolvePage(func(page *ListPosts) any { return nonNilSlice(page.Items) })},
+			"edges":      {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(postEdge))), Resolve: resolvePage(func(page *ListPosts) any { return nonNilSlice(page.Items) })},
+			"pageInfo":   {Type: graphql.NewNonNull(pageInfo), Resolve: func(p graphql.ResolveParams) (any, error) { return p.Source, nil }},
+			"totalCount": {Type: graphql.NewNonNull(graphql.Int), Resolve: api.resolveTotalCount},
+		},
+	})
+	tag := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Tag",
+		Fields: graphql.Fields{
+			"name":  {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) { return p.Source.(TagWithCount).Tag, nil }},
+			"count": {Type: graphql.NewNonNull(graphql.Int)},
+			"posts": {
+				Type: graphql.NewNonNull(postConnectionType),
+				Args: pageArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return api.resolvePosts(p.Context, p.Source.(TagWithCount).Tag, p.Args)
+				},
+			},
+		},
+	})
+	postsArgs := graphql.FieldConfigArgument{"tag": {Type: graphql.String}}
+	for name, arg := range pageArgs {
+		postsArgs[name] = arg
+	}
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"posts": {
+					Type: graphql.NewNonNull(postConnectionType),
+					Args: postsArgs,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						tag, _ := p.Args["tag"].(string)
+						return api.resolvePosts(p.Context, tag, p.Args)
+					},
+				},
+				"post": {
+					Type:    post,
+					Args:    graphql.FieldConfigArgument{"slug": {Type: graphql.NewNonNull(graphql.String)}},
+					Resolve: api.resolvePost,
+				},
+				"tags": {
+					Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tag))),
+					Resolve: api.resolveTags,
+				},
+			},
+		}),
+	})
+}
+
+func (api *GraphQLAPI) resolvePosts(ctx context.Context, tag string, args map[string]any) (any, error) {
+	query := ListPostsQuery{Tag: tag}
+	query.Limit, _ = args["first"].(int)
+	query.Sort, _ = args["sort"].(string)
+	query.From, _ = args["from"].(string)
+	query.To, _ = args["to"].(string)
+	after, _ := args["after"].(string)
+	before, _ := args["before"].(string)
+	if after != "" && before != "" {
+		return nil, graphQLDomainError(NewValidationError([]FieldError{{Field: "before", Message: "can't be combined with after"}}))
+	}
+	query.Cursor = after + before
+	var fieldErrors []FieldError
+	if query.Limit < 1 {
+		fieldErrors = append(fieldErrors, FieldError{Field: "first", Message: "must be at least 1"})
+	}
+	for _, field := range []struct{ name, value string }{{"from", query.From}, {"to", query.To}} {
+		if field.value != "" && !isDate(field.value, "2006-01-02") {
+			fieldErrors = append(fieldErrors, FieldError{Field: field.name, Message: "must be a date formatted as 2006-01-02"})
+		}
+	}
+	fieldErrors = append(fieldErrors, query.Validate(api.limits.Max(legacyPrefix+"/posts"))...)
+	if len(fieldErrors) > 0 {
+		for i := range fieldErrors {
+			if fieldErrors[i].Field == "limit" {
+				fieldErrors[i].Field = "first"
+			}
+		}
+		return nil, graphQLDomainError(NewValidationError(fieldErrors))
+	}
+	page, err := api.repository.GetPosts(ctx, query)
+	if err != nil {
+		return nil, graphQLDomainError(err)
+	}
+	if !cacheableListing(query, page) {
+		markUncacheable(ctx)
+	}
+	return &postConnection{query: query, page: page}, nil
+}
+
+func (api *GraphQLAPI) resolvePost(p graphql.ResolveParams) (any, error) {
+	post, err := api.repository.GetPost(p.Context, p.Args["slug"].(string))
+	var notFound *NotFoundError
+	if errors.As(err, &notFound) {
+		// any slug can be asked for, only existing posts are cached
+		markUncacheable(p.Context)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphQLDomainError(err)
+	}
+	return *post, nil
+}
+
+func (api *GraphQLAPI) resolveTags(p graphql.ResolveParams) (any, error) {
+	tags, err := api.repository.GetTags(p.Context)
+	if err != nil {
+		return nil, graphQLDomainError(err)
+	}
+	if tags == nil {
+		return []TagWithCount{}, nil
+	}
+	return *tags, nil
+}
+
+// resolveBody returns the body already loaded by post(slug) or reads it for posts coming from listings
+func (api *GraphQLAPI) resolveBody(p graphql.ResolveParams) (any, error) {
+	post := p.Source.(Post)
+	if post.Body != "" || post.BodyHash == "" {
+		return post.Body, nil
+	}
+	body, err := api.repository.getPostBody(p.Context, post)
+	if err != nil {
+		return nil, graphQLDomainError(err)
+	}
+	return body, nil
+}
+
+// resolveToc reads the table of contents from the POST item when the post comes from a listing, which leaves it out
+func (api *GraphQLAPI) resolveToc(p graphql.ResolveParams) (any, error) {
+	post := p.Source.(Post)
+	if len(post.Toc) > 0 || post.WordCount == 0 {
+		return nonNilSlice(post.Toc), nil
+	}
+	stored, err := api.repository.getPostItem(p.Context, post.Slug)
+	if err != nil {
+		return nil, graphQLDomainError(err)
+	}
+	if stored == nil {
+		return []TocItem{}, nil
+	}
+	return nonNilSlice(stored.Toc), nil
+}
+
+func (api *GraphQLAPI) resolveRelated(p graphql.ResolveParams) (any, error) {
+	related, err := api.repository.GetRelated(p.Context, p.Source.(Post).Slug)
+	if err != nil {
+		return nil, graphQLDomainError(err)
+	}
+	return related, nil
+}
+
+func (api *GraphQLAPI) resolveNeighbours(p graphql.ResolveParams) (any, error) {
+	tag, _ := p.Args["tag"].(string)
+	neighbours, err := api.repository.GetNeighbours(p.Context, p.Source.(Post).Slug, normalizeQueryTag(tag))
+	if err != nil {
+		return nil, graphQLDomainError(err)
+	}
+	return neighbours, nil
+}
+
+func (api *GraphQLAPI) resolveTotalCount(p graphql.ResolveParams) (any, error) {
+	connection := p.Source.(*postConnection)
+	total, err := api.repository.CountPosts(p.Context, connection.query.Tag)
+	if err != nil {
+		return nil, graphQLDomainError(err)
+	}
+	return total, nil
+}
+
+func resolvePage(field func(page *ListPosts) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return field(p.Source.(*postConnection).page), nil
+	}
+}
+
+func resolveNeighbour(field func(neighbours *PostNeighbours) *Post) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		if neighbour := field(p.Source.(*PostNeighbours)); neighbour != nil {
+			return *neighbour, nil
+		}
+		return nil, nil
+	}
+}
+
+func resolveOptionalString(field func(post Post) string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return optionalString(field(p.Source.(Post))), nil
+	}
+}
+
+func resolveOptionalInt(field func(post Post) int) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		if value := field(p.Source.(Post)); value != 0 {
+			return value, nil
+		}
+		return nil, nil
+	}
+}
+
+func optionalString(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func nonNilSlice[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+// graphQLErrorDetails carries the problem details of a domain error as GraphQL error extensions
+type graphQLErrorDetails struct {
+	problem *RestError
+}
+
+func (e *graphQLErrorDetails) Error() string {
+	return e.problem.Detail
+}
+
+func (e *graphQLErrorDetails) Extensions() map[string]any {
+	extensions := map[string]any{"code": graphQLErrorCode(e.problem.Status), "status": e.problem.Status}
+	if len(e.problem.Errors) > 0 {
+		extensions["errors"] = e.problem.Errors
+	}
+	return extensions
+}
+
+// graphQLDomainError maps a repository or validation error like ProblemMiddleware does for REST
+func graphQLDomainError(err error) error {
+	problem := NewRestError(err)
+	if problem.Status >= http.StatusInternalServerError {
+		slog.Error("GraphQL resolver failed", "Error", err)
+	}
+	return &graphQLErrorDetails{problem: problem}
+}
+
+func graphQLErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "BAD_USER_INPUT"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	default:
+		return "INTERNAL_SERVER_ERROR"
+	}
+}
+
+func newGraphQLError(code, message string) GraphQLError {
+	return GraphQLError{Message: message, Extensions: map[string]any{"code": code}}
+}
+
+// Execute resolves the persisted query if needed, then parses, validates, costs and runs the request.
+// register tells whether the client may register the persisted query it sends along its query
+func (api *GraphQLAPI) Execute(ctx context.Context, request GraphQLRequest, register bool) GraphQLResponse {
+	query, errorResponse := api.resolveQuery(ctx, request)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query), Name: "GraphQL request"})})
+	if err != nil {
+		return GraphQLResponse{Errors: formatGraphQLErrors(gqlerrors.FormatErrors(err))}
+	}
+	if validation := graphql.ValidateDocument(&api.schema, document, nil); !validation.IsValid {
+		return GraphQLResponse{Errors: formatGraphQLErrors(validation.Errors)}
+	}
+	complexity, depth := queryCost(document, request.OperationName, request.Variables)
+	if depth > api.maxDepth {
+		return GraphQLResponse{Errors: []GraphQLError{newGraphQLError("QUERY_TOO_DEEP", fmt.Sprintf("Query depth %d exceeds the maximum of %d", depth, api.maxDepth))}}
+	}
+	if complexity > api.maxComplexity {
+		return GraphQLResponse{Errors: []GraphQLError{newGraphQLError("QUERY_TOO_COMPLEX", fmt.Sprintf("Query complexity %d exceeds the maximum of %d", complexity, api.maxComplexity))}}
+	}
+	// only queries that passed validation and costing get persisted
+	if hash := persistedQueryHash(request.Extensions); register && hash != "" && request.Query != "" {
+		if err := api.persisted.Put(ctx, hash, query); err != nil {
+			slog.ErrorContext(ctx, "Failed to persist GraphQL query", "Error", err)
+		}
+	}
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        api.schema,
+		AST:           document,
+		OperationName: request.OperationName,
+		Args:          request.Variables,
+		Context:       ctx,
+	})
+	return GraphQLResponse{Data: result.Data, Errors: formatGraphQLErrors(result.Errors)}
+}
+
+// resolveQuery implements automatic persisted queries: a hash alone is looked up,
+// a hash along with its query is checked and, for allowed clients, registered once the query is validated
+func (api *GraphQLAPI) resolveQuery(ctx context.Context, request GraphQLRequest) (string, *GraphQLResponse) {
+	hash := persistedQueryHash(request.Extensions)
+	switch {
+	case hash == "" && request.Query == "":
+		return "", &GraphQLResponse{Errors: []GraphQLError{newGraphQLError("BAD_USER_INPUT", "Must provide a query or a persisted query hash")}}
+	case hash == "":
+		return request.Query, nil
+	case request.Query != "":
+		if queryHash(request.Query) != hash {
+			return "", &GraphQLResponse{Errors: []GraphQLError{newGraphQLError("BAD_USER_INPUT", "provided sha does not match query")}}
+		}
+		return request.Query, nil
+	}
+	query, err := api.persisted.Get(ctx, hash)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read persisted GraphQL query", "Error", err)
+		return "", &GraphQLResponse{Errors: []GraphQLError{newGraphQLError("INTERNAL_SERVER_ERROR", "Unexpected error")}}
+	}
+	if query == "" {
+		return "", &GraphQLResponse{Errors: []GraphQLError{newGraphQLError("PERSISTED_QUERY_NOT_FOUND", "PersistedQueryNotFound")}}
+	}
+	return query, nil
+}
+
+// persistedQueryHash returns the sha256Hash of the persistedQuery extension, or ""
+func persistedQueryHash(extensions map[string]any) string {
+	persistedQuery, _ := extensions["persistedQuery"].(map[string]any)
+	hash, _ := persistedQuery["sha256Hash"].(string)
+	return hash
+}
+
+func formatGraphQLErrors(formatted []gqlerrors.FormattedError) []GraphQLError {
+	var graphQLErrors []GraphQLError
+	for _, err := range formatted {
+		graphQLErrors = append(graphQLErrors, GraphQLError{Message: err.Message, Path: err.Path, Extensions: err.Extensions})
+	}
+	return graphQLErrors
+}
+
+// queryCost estimates the cost of the selected operation, every field costs 1 or its graphQLFieldCosts entry
+// and selections under a list are multiplied by its page size, it also returns the selection depth
+func queryCost(document *ast.Document, operationName string, variables map[string]any) (int, int) {
+	fragments := map[string]*ast.FragmentDefinition{}
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operation == nil || (definition.Name != nil && definition.Name.Value == operationName) {
+				operation = definition
+			}
+		}
+	}
+	if operation == nil {
+		return 0, 0
+	}
+	var cost func(selectionSet *ast.SelectionSet, visiting map[string]bool) (int, int)
+	cost = func(selectionSet *ast.SelectionSet, visiting map[string]bool) (int, int) {
+		if selectionSet == nil {
+			return 0, 0
+		}
+		total, depth := 0, 0
+		for _, selection := range selectionSet.Selections {
+			var selectionCost, selectionDepth int
+			switch selection := selection.(type) {
+			case *ast.Field:
+				childCost, childDepth := cost(selection.SelectionSet, visiting)
+				fieldCost, ok := graphQLFieldCosts[selection.Name.Value]
+				if !ok {
+					fieldCost = 1
+				}
+				selectionCost = fieldCost + childCost*listSize(selection, variables)
+				selectionDepth = childDepth + 1
+			case *ast.InlineFragment:
+				selectionCost, selectionDepth = cost(selection.SelectionSet, visiting)
+			case *ast.FragmentSpread:
+				name := selection.Name.Value
+				// fragment cycles are rejected by validation, guard anyway
+				if fragment, ok := fragments[name]; ok && !visiting[name] {
+					visiting[name] = true
+					selectionCost, selectionDepth = cost(fragment.SelectionSet, visiting)
+					delete(visiting, name)
+				}
+			}
+			total += selectionCost
+			depth = max(depth, selectionDepth)
+		}
+		return total, depth
+	}
+	return cost(operation.SelectionSet, map[string]bool{})
+}
+
+// listSize is the number of items the selections of a field are resolved for
+func listSize(field *ast.Field, variables map[string]any) int {
+	switch field.Name.Value {
+	case "posts":
+		for _, argument := range field.Arguments {
+			if argument.Name.Value == "first" {
+				return max(argumentInt(argument.Value, variables), 1)
+			}
+		}
+		return defaultMaxLimit
+	case "related":
+		return relatedLimit
+	case "tags":
+		if field.SelectionSet != nil {
+			return graphQLTagsEstimate
+		}
+	}
+	return 1
+}
+
+func argumentInt(value ast.Value, variables map[string]any) int {
+	switch value := value.(type) {
+	case *ast.IntValue:
+		number, _ := strconv.Atoi(value.Value)
+		return number
+	case *ast.Variable:
+		switch number := variables[value.Name.Value].(type) {
+		case float64:
+			return int(number)
+		case int:
+			return number
+		case json.Number:
+			parsed, _ := number.Int64()
+			return int(parsed)
+		}
+	}
+	return defaultMaxLimit
+}
+
+// GraphQLHandler serves GraphQL over GET, cacheable by the CDN when used with persisted query hashes, and POST
+func (bc *BlogController) GraphQLHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	var request GraphQLRequest
+	if c.Request.Method == http.MethodGet {
+		var query GraphQLQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			abortWithError(c, NewBindingError(err))
+			return
+		}
+		request = GraphQLRequest{Query: query.Query, OperationName: query.OperationName}
+		encoded := []struct {
+			value  string
+			target *map[string]any
+		}{{query.Variables, &request.Variables}, {query.Extensions, &request.Extensions}}
+		for _, field := range encoded {
+			if field.value == "" {
+				continue
+			}
+			if err := json.Unmarshal([]byte(field.value), field.target); err != nil {
+				abortWithError(c, &ValidationError{Message: "variables and extensions must be JSON objects", Err: err})
+				return
+			}
+		}
+	} else if err := c.ShouldBindJSON(&request); err != nil {
+		abortWithError(c, NewBindingError(err))
+		return
+	}
+	response := bc.graphql.Execute(ctx, request, bc.graphql.persisted.CanRegister(c.GetHeader("X-API-Key")))
+	// errors, a missing persisted query in particular, must not stick at the CDN. GETs carrying the query text
+	// aren't cached either, any document would get its own cache entry, only GETs naming a persisted query are
+	if len(response.Errors) > 0 || (c.Request.Method == http.MethodGet && request.Query != "") {
+		c.Header("Cache-Control", "no-store")
+		c.Header("Expires", "0")
+	}
+	c.JSON(http.StatusOK, response)
+}
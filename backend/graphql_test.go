@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func TestGraphQLRejectsExpensiveQueries(t *testing.T) {
+	api := NewGraphQLAPI(nil, RouteLimits{})
+	cases := map[string]string{
+		"QUERY_TOO_COMPLEX": `{ tags { posts(first: 6) { nodes { body related { body } } } } }`,
+		"QUERY_TOO_DEEP":    `{ post(slug: "a") { related { related { related { related { related { related { related { slug } } } } } } } } }`,
+	}
+	for code, query := range cases {
+		response := api.Execute(context.Background(), GraphQLRequest{Query: query}, false)
+		if len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != code {
+			t.Errorf("expected %s, got %+v", code, response.Errors)
+		}
+	}
+}
+
+func TestGraphQLQueryCost(t *testing.T) {
+	api := NewGraphQLAPI(nil, RouteLimits{})
+	query := `query Page($first: Int) { posts(first: $first) { nodes { ...Card } totalCount } }
+		fragment Card on Post { slug title }`
+	response := api.Execute(context.Background(), GraphQLRequest{Query: query + " {"}, false)
+	if len(response.Errors) == 0 {
+		t.Fatal("expected a syntax error")
+	}
+
+	document := mustParse(t, query)
+	complexity, depth := queryCost(document, "Page", map[string]any{"first": float64(3)})
+	// posts + 3 * (nodes + slug + title + totalCount)
+	if complexity != 1+3*(1+2+2) || depth != 3 {
+		t.Errorf("unexpected cost %d and depth %d", complexity, depth)
+	}
+}
+
+func TestGraphQLPersistedQueries(t *testing.T) {
+	bc := newTestController()
+	query := `{ __typename }`
+	hash := queryHash(query)
+	router := NewRouter(bc)
+
+	extensions := `{"persistedQuery":{"version":1,"sha256Hash":"` + queryHash("{ other }") + `"}}`
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/blog/v1/graphql?query="+url.QueryEscape(query)+"&extensions="+url.QueryEscape(extensions), nil))
+	response := decodeGraphQLResponse(t, recorder)
+	if len(response.Errors) != 1 || recorder.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected an uncacheable hash mismatch error, got %+v", response.Errors)
+	}
+
+	bc.graphql.persisted.cache.put(readCacheEntry{key: persistedQuerySortKey(hash), value: query}, 0)
+	extensions = `{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}`
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/blog/v1/graphql?extensions="+url.QueryEscape(extensions), nil))
+	response = decodeGraphQLResponse(t, recorder)
+	data, _ := response.Data.(map[string]any)
+	if len(response.Errors) > 0 || data["__typename"] != "Query" {
+		t.Errorf("unexpected response %+v", response)
+	}
+	if recorder.Header().Get("Cache-Control") == "no-store" {
+		t.Error("successful persisted query responses should stay cacheable")
+	}
+}
+
+func TestGraphQLCachesOnlyPersistedGets(t *testing.T) {
+	fake, repository := newFakeDynamo(t)
+	bc := NewBlogController(nil, "", nil, repository, RouteLimits{})
+	router := NewRouter(bc)
+	query := `{ posts { nodes { slug } } }`
+	hash := queryHash(query)
+	send := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", target, nil))
+		if response := decodeGraphQLResponse(t, recorder); len(response.Errors) > 0 {
+			t.Fatalf("unexpected errors %+v", response.Errors)
+		}
+		return recorder
+	}
+
+	recorder := send("/blog/v1/graphql?query=" + url.QueryEscape(query))
+	if recorder.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected GETs with the query text to be uncacheable, got %q", recorder.Header().Get("Cache-Control"))
+	}
+	if recorded := fake.partition(surrogateKeyPartitionKey(listPostsKey)); len(recorded) > 0 {
+		t.Errorf("expected uncacheable responses not to be recorded, got %v", recorded)
+	}
+
+	bc.graphql.persisted.cache.put(readCacheEntry{key: persistedQuerySortKey(hash), value: query}, 0)
+	extensions := `{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}`
+	recorder = send("/blog/v1/graphql?extensions=" + url.QueryEscape(extensions))
+	if recorder.Header().Get("Cache-Control") == "no-store" {
+		t.Error("persisted query GETs should stay cacheable")
+	}
+	if recorded := fake.partition(surrogateKeyPartitionKey(listPostsKey)); len(recorded) != 1 {
+		t.Errorf("expected the persisted query path to be recorded, got %v", recorded)
+	}
+}
+
+func TestGraphQLPersistedQueryRegistration(t *testing.T) {
+	var puts []map[string]map[string]string
+	repository := newFakeDynamoRepository(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Amz-Target") {
+		case "DynamoDB_20120810.PutItem":
+			var request struct{ Item map[string]map[string]string }
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			puts = append(puts, request.Item)
+		}
+		w.Write([]byte(`{}`))
+	})
+	t.Setenv("GRAPHQL_PERSIST_API_KEYS", "publisher")
+	api := NewGraphQLAPI(repository, RouteLimits{})
+	query := `{ __typename }`
+	request := GraphQLRequest{Query: query, Extensions: map[string]any{"persistedQuery": map[string]any{"sha256Hash": queryHash(query)}}}
+
+	if api.persisted.CanRegister("") || api.persisted.CanRegister("guess") || !api.persisted.CanRegister("publisher") {
+		t.Error("only the configured API keys may register queries")
+	}
+	if response := api.Execute(context.Background(), request, false); len(response.Errors) > 0 || len(puts) > 0 {
+		t.Errorf("anonymous clients should run the query without registering it, got %+v and %d writes", response.Errors, len(puts))
+	}
+	if response := api.Execute(context.Background(), request, true); len(response.Errors) > 0 || len(puts) != 1 {
+		t.Fatalf("expected the query to be registered, got %+v and %d writes", response.Errors, len(puts))
+	}
+	if puts[0]["expires_at"]["N"] == "" {
+		t.Error("registered queries should expire")
+	}
+}
+
+func decodeGraphQLResponse(t *testing.T, recorder *httptest.ResponseRecorder) GraphQLResponse {
+	t.Helper()
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var response GraphQLResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func mustParse(t *testing.T, query string) *ast.Document {
+	t.Helper()
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
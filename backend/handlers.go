@@ -2,10 +2,14 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"io"
 	"log/slog"
-	"strconv"
+	"sync"
+
+	"cloudificando/ingestion"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/gin-gonic/gin"
@@ -16,36 +20,45 @@ type BlogController struct {
 	migration  *Migration
 	tableName  string
 	repository *BlogRepository
+	limits     RouteLimits
+	openapi    func() *OpenAPIDocument
+	graphql    *GraphQLAPI
+	// surrogateKeys maps cache tags to the cached paths writes invalidate
+	surrogateKeys *SurrogateKeyIndex
+	warmer        *CacheWarmer
+	rateLimiter   *RateLimiter
+	pubsubAuth    *PubSubAuthenticator
 }
 
-func NewBlogController(db *dynamodb.Client, tableName string, migration *Migration, repository *BlogRepository) *BlogController {
-	return &BlogController{
-		db:         db,
-		tableName:  tableName,
-		migration:  migration,
-		repository: repository,
+func NewBlogController(db *dynamodb.Client, tableName string, migration *Migration, repository *BlogRepository, limits RouteLimits) *BlogController {
+	bc := &BlogController{
+		db:            db,
+		tableName:     tableName,
+		migration:     migration,
+		repository:    repository,
+		limits:        limits,
+		graphql:       NewGraphQLAPI(repository, limits),
+		surrogateKeys: NewSurrogateKeyIndex(repository),
+		warmer:        NewCacheWarmerFromEnv(repository),
+		rateLimiter:   NewRateLimiterFromEnv(repository),
+		pubsubAuth:    NewPubSubAuthenticatorFromEnv(),
 	}
+	bc.openapi = sync.OnceValue(func() *OpenAPIDocument {
+		return NewOpenAPIDocument(APIRoutes(bc.Routes()), bc.limits)
+	})
+	return bc
 }
 
 // GetPostsHandler handles fetching paginated posts from DynamoDB
 func (bc *BlogController) GetPostsHandler(c *gin.Context) {
 	ctx := c.Request.Context()
-	repository := bc.repository
-	cursor := c.DefaultQuery("cursor", "")
-	limitStr := c.DefaultQuery("limit", "6")
-	tag := c.DefaultQuery("tag", "")
-
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 || limit > 6 {
-		c.AbortWithStatusJSON(400, gin.H{
-			"error": "Invalid limit",
-		})
+	var query ListPostsQuery
+	if !bc.bindListQuery(c, &query) {
+		return
 	}
-	result, err := repository.GetPosts(ctx, limit, tag, cursor)
+	result, err := bc.listPosts(ctx, query)
 	if err != nil {
-		c.AbortWithStatusJSON(500, gin.H{
-			"error": "Failed to retrieve posts",
-		})
+		abortWithError(c, err)
 		return
 	}
 	c.JSON(200, result)
@@ -53,14 +66,79 @@ func (bc *BlogController) GetPostsHandler(c *gin.Context) {
 	slog.InfoContext(ctx, "Posts retrieved successfully")
 }
 
+// listPosts returns a page of posts along with the total when the query asks for it
+func (bc *BlogController) listPosts(ctx context.Context, query ListPostsQuery) (*ListPosts, error) {
+	result, err := bc.repository.GetPosts(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if !cacheableListing(query, result) {
+		markUncacheable(ctx)
+	}
+	if query.Count {
+		total, err := bc.repository.CountPosts(ctx, query.Tag)
+		if err != nil {
+			return nil, err
+		}
+		result.Total = &total
+	}
+	return result, nil
+}
+
+// GetPostHandler returns a single post by slug
+func (bc *BlogController) GetPostHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	post, err := bc.repository.GetPost(ctx, c.Param("slug"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(200, post)
+}
+
+// GetNeighboursHandler returns the previous and next posts by date, optionally within a tag
+func (bc *BlogController) GetNeighboursHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	var query NeighboursQuery
+	if !bc.bindListQuery(c, &query) {
+		return
+	}
+	neighbours, err := bc.repository.GetNeighbours(ctx, c.Param("slug"), query.Tag)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(200, neighbours)
+}
+
+// GetSeriesHandler returns the posts of a series in order
+func (bc *BlogController) GetSeriesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	series, err := bc.repository.GetSeries(ctx, c.Param("series"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(200, series)
+}
+
+// GetRelatedHandler returns the precomputed "you might also like" posts of a post
+func (bc *BlogController) GetRelatedHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	related, err := bc.repository.GetRelated(ctx, c.Param("slug"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(200, related)
+}
+
 func (bc *BlogController) GetTagsHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 	repository := bc.repository
 	result, err := repository.GetTags(ctx)
 	if err != nil {
-		c.AbortWithStatusJSON(500, gin.H{
-			"error": "Unexpected error",
-		})
+		abortWithError(c, err)
 		return
 	}
 	// Respond with the tags and their counts array outside object
@@ -73,137 +151,125 @@ func (bc *BlogController) PostsUpdatedGcpSubscriptionHandler(c *gin.Context) {
 
 	// Bind JSON payload
 	if err := c.ShouldBindJSON(&event); err != nil {
-		slog.ErrorContext(ctx, "Invalid request payload", "Error", err)
-		c.AbortWithStatusJSON(400, gin.H{
-			"error": "Invalid request payload",
-		})
+		abortWithError(c, NewBindingError(err))
 		return
 	}
 
 	// Handle event types with a switch statement
 	switch event.Message.Attributes.EventType {
 	case "POST_CREATED", "META_UPDATED":
-		var post Post
-		dataDecoded, _ := base64.StdEncoding.DecodeString(event.Message.Data)
-		if err := json.Unmarshal(dataDecoded, &post); err != nil {
-			c.AbortWithStatusJSON(400, gin.H{
-				"error": "Invalid post data",
-			})
+		post, err := decodeEventPost(event.Message.Data)
+		if err != nil {
+			abortWithError(c, err)
 			return
 		}
-		if err := repository.UpsertPost(ctx, post); err != nil {
-			slog.Error("Failed to upsert post", "Error", err)
-			c.AbortWithStatusJSON(500, gin.H{
-				"error": "Failed to upsert post",
-			})
+		if err := bc.upsertPost(ctx, &post, "data."); err != nil {
+			abortWithError(c, err)
 			return
 		}
-		c.JSON(200, gin.H{
-			"message": "Post upserted successfully",
-		})
-		slog.Info("Post upserted successfully", "Slug", post.Slug)
+		c.JSON(200, MessageResponse{Message: "Post upserted successfully"})
 
 	case "POST_DELETED":
+		if err := bc.deletePost(ctx, event.Message.Attributes.Slug, "attributes.slug"); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(200, MessageResponse{Message: "Post deleted successfully"})
+	case "CONTENT_UPDATED":
+		post, err := decodeEventPost(event.Message.Data)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
 		slug := event.Message.Attributes.Slug
-		if slug == "" {
-			c.AbortWithStatusJSON(400, gin.H{
-				"error": "Missing slug attribute",
-			})
+		fieldErrors := append(ValidateSlug("attributes.slug", slug), ValidateBody("data.body", post.Body)...)
+		if len(fieldErrors) > 0 {
+			abortWithError(c, NewValidationError(fieldErrors))
 			return
 		}
-		if err := repository.DeletePost(ctx, slug); err != nil {
-			slog.Error("Failed to delete post", "Error", err)
-			c.AbortWithStatusJSON(500, gin.H{
-				"error": "Failed to delete post",
-			})
+		updated, err := repository.UpdatePostBody(ctx, slug, post.Body)
+		if err != nil {
+			abortWithError(c, err)
 			return
 		}
-		c.JSON(200, gin.H{
-			"message": "Post deleted successfully",
-		})
-		slog.Info("Post deleted successfully", "Slug", slug)
-	case "CONTENT_UPDATED":
-		c.JSON(200, gin.H{
-			"message": "ok",
-		})
+		c.JSON(200, MessageResponse{Message: "Post body updated successfully"})
+		slog.Info("Post body updated successfully", "Slug", slug)
+		bc.invalidatePost(ctx, slug, updated)
 	default:
-		c.AbortWithStatusJSON(400, gin.H{
-			"error": "Invalid event type",
-		})
+		abortWithError(c, NewValidationError([]FieldError{{Field: "attributes.eventType", Message: "Invalid event type"}}))
 		return
 	}
-	_ = repository.InvalidateCdnCache(ctx, "/blog/*")
+}
+
+// decodeEventPost decodes the post carried base64 encoded in the data of a Pub/Sub message
+func decodeEventPost(data string) (Post, error) {
+	var post Post
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return post, &ValidationError{Message: "Invalid post data, expected base64", Err: err}
+	}
+	if err := json.Unmarshal(decoded, &post); err != nil {
+		return post, &ValidationError{Message: "Invalid post data", Err: err}
+	}
+	return post, nil
 }
 
 func (bc *BlogController) UpsertPostHandler(c *gin.Context) {
 	//db := bc.db
 	ctx := c.Request.Context()
-	repository := bc.repository
 	var post Post
 	if err := c.ShouldBindJSON(&post); err != nil {
-		c.AbortWithStatusJSON(400, gin.H{
-			"error": "Invalid request payload",
-		})
-		return
-	}
-
-	// Validate required fields
-	if post.Slug == "" || post.Title == "" || post.CreatedAt == "" {
-		c.AbortWithStatusJSON(400, gin.H{
-			"error": "Missing required fields",
-		})
+		abortWithError(c, NewBindingError(err))
 		return
 	}
-	err := repository.UpsertPost(ctx, post)
-
-	if err != nil {
-		slog.Error("Failed to transact write items", "Error", err)
-		c.AbortWithStatusJSON(500, gin.H{
-			"error": "Failed to upsert post",
-		})
+	if err := bc.upsertPost(ctx, &post, ""); err != nil {
+		abortWithError(c, err)
 		return
 	}
-
-	c.JSON(200, gin.H{
-		"message": "Post upserted successfully",
-	})
-	slog.Info("Post upserted successfully", "Slug", post.Slug)
+	c.JSON(200, MessageResponse{Message: "Post upserted successfully"})
 }
 
-func (bc *BlogController) DeletePostHandler(c *gin.Context) {
+// IngestMdxHandler upserts a post from a raw MDX document, frontmatter included, sent as the request body
+func (bc *BlogController) IngestMdxHandler(c *gin.Context) {
 	ctx := c.Request.Context()
-	repository := bc.repository
 	slug := c.Param("slug")
-	if slug == "" {
-		c.AbortWithStatusJSON(400, gin.H{
-			"error": "Missing slug parameter",
-		})
+	raw, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		abortWithError(c, &ValidationError{Message: "Failed to read request body", Err: err})
 		return
 	}
-	err := repository.DeletePost(ctx, slug)
+	document, err := ingestion.Parse(slug, raw)
 	if err != nil {
-		slog.Error("Failed to delete post", "Error", err)
-		c.AbortWithStatusJSON(500, gin.H{
-			"error": "Failed to delete post",
-		})
+		abortWithError(c, &ValidationError{Message: err.Error(), Err: err})
 		return
 	}
+	if !document.Frontmatter.Published {
+		c.JSON(200, MessageResponse{Message: "Post is not published, skipped"})
+		return
+	}
+	post := NewPostFromDocument(document)
+	if err := bc.upsertPost(ctx, &post, ""); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(200, MessageResponse{Message: "Post upserted successfully"})
+}
 
-	c.JSON(200, gin.H{
-		"message": "Post deleted successfully",
-	})
-	slog.Info("Post deleted successfully", "Slug", slug)
+func (bc *BlogController) DeletePostHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	if err := bc.deletePost(ctx, c.Param("slug"), "slug"); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(200, MessageResponse{Message: "Post deleted successfully"})
 }
 
 func (bc *BlogController) HardSyncHandler(c *gin.Context) {
 	//migration := bc.migration
-	repository := bc.repository
 	ctx := c.Request.Context()
 	var body HardSyncRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.AbortWithStatusJSON(400, gin.H{
-			"error": err,
-		})
+		abortWithError(c, NewBindingError(err))
 		return
 	}
 	// TODO: this makes big downtime, refactor to delete all items instead of dropping table
@@ -223,16 +289,59 @@ func (bc *BlogController) HardSyncHandler(c *gin.Context) {
 	//	})
 	//	return
 	//}
-	err := repository.UpsertPostsBatch(ctx, body.Posts)
-	if err != nil {
-		slog.ErrorContext(ctx, "Failed to upsert posts", "Error", err)
-		c.AbortWithStatusJSON(500, gin.H{
-			"error": "Unexpected error",
-		})
+	if err := bc.syncPosts(ctx, body.Posts); err != nil {
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(200, gin.H{
-		"message": "ok",
-	})
-	_ = repository.InvalidateCdnCache(ctx, "/blog/*")
+	c.JSON(200, MessageResponse{Message: "ok"})
+}
+
+// The writes below are shared by the REST handlers and the Connect service: validate, write, log then purge
+// what the write changed. Field names of validation errors are prefixed with field
+
+// upsertPost validates and normalizes a post then writes it
+func (bc *BlogController) upsertPost(ctx context.Context, post *Post, field string) error {
+	if fieldErrors := ValidatePost(post, field); len(fieldErrors) > 0 {
+		return NewValidationError(fieldErrors)
+	}
+	previous, err := bc.repository.UpsertPost(ctx, *post)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Post upserted successfully", "Slug", post.Slug)
+	bc.invalidatePost(ctx, post.Slug, post, previous)
+	return nil
+}
+
+// deletePost deletes the post with the given slug
+func (bc *BlogController) deletePost(ctx context.Context, slug, field string) error {
+	if fieldErrors := ValidateSlug(field, slug); len(fieldErrors) > 0 {
+		return NewValidationError(fieldErrors)
+	}
+	deleted, err := bc.repository.DeletePost(ctx, slug)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Post deleted successfully", "Slug", slug)
+	bc.invalidatePost(ctx, slug, deleted)
+	return nil
+}
+
+// syncPosts upserts every post then rebuilds the tag counters and related posts
+func (bc *BlogController) syncPosts(ctx context.Context, posts []Post) error {
+	if fieldErrors := ValidatePosts(posts, "posts"); len(fieldErrors) > 0 {
+		return NewValidationError(fieldErrors)
+	}
+	if err := bc.repository.UpsertPostsBatch(ctx, posts); err != nil {
+		return err
+	}
+	if err := bc.repository.RebuildCounters(ctx); err != nil {
+		return err
+	}
+	if err := bc.repository.RefreshAllRelated(ctx); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Posts synced successfully", "Posts", len(posts))
+	bc.invalidateAll(ctx, postSlugs(posts)...)
+	return nil
 }
@@ -0,0 +1,88 @@
+// Package ingestion parses raw MDX posts, YAML frontmatter followed by the body,
+// into the fields the blog stores, so publishers can push files as they are in the content repository
+package ingestion
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidDocument is returned when a document can't be parsed or misses required frontmatter
+var ErrInvalidDocument = errors.New("invalid mdx document")
+
+var frontmatterDelimiter = []byte("---")
+
+// Frontmatter mirrors the YAML header of the posts in the content repository
+type Frontmatter struct {
+	Title       string   `yaml:"title"`
+	Description string   `yaml:"description"`
+	Tags        []string `yaml:"tags"`
+	Date        string   `yaml:"date"` // stored as the post created_at
+	Published   bool     `yaml:"published"`
+	Series      string   `yaml:"series"`
+	SeriesOrder int      `yaml:"seriesOrder"`
+}
+
+// Document is a parsed MDX post
+type Document struct {
+	Slug        string
+	Frontmatter Frontmatter
+	Body        string
+}
+
+// Parse splits a raw MDX document into its frontmatter and body and validates the frontmatter
+func Parse(slug string, raw []byte) (*Document, error) {
+	if strings.TrimSpace(slug) == "" {
+		return nil, fmt.Errorf("%w: missing slug", ErrInvalidDocument)
+	}
+	header, body, err := splitFrontmatter(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var frontmatter Frontmatter
+	if err := yaml.Unmarshal(header, &frontmatter); err != nil {
+		return nil, fmt.Errorf("%w: frontmatter: %v", ErrInvalidDocument, err)
+	}
+	if strings.TrimSpace(frontmatter.Title) == "" {
+		return nil, fmt.Errorf("%w: frontmatter title is required", ErrInvalidDocument)
+	}
+	if strings.TrimSpace(frontmatter.Date) == "" {
+		return nil, fmt.Errorf("%w: frontmatter date is required", ErrInvalidDocument)
+	}
+	if frontmatter.Series != "" && frontmatter.SeriesOrder < 1 {
+		return nil, fmt.Errorf("%w: frontmatter seriesOrder is required with series", ErrInvalidDocument)
+	}
+
+	return &Document{
+		Slug:        slug,
+		Frontmatter: frontmatter,
+		Body:        string(body),
+	}, nil
+}
+
+// splitFrontmatter returns the YAML between the leading "---" lines and everything after them
+func splitFrontmatter(raw []byte) ([]byte, []byte, error) {
+	raw = bytes.TrimPrefix(raw, []byte("\ufeff"))
+	raw = bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	firstLine, rest, _ := bytes.Cut(raw, []byte("\n"))
+	if !bytes.Equal(bytes.TrimSpace(firstLine), frontmatterDelimiter) {
+		return nil, nil, fmt.Errorf("%w: missing frontmatter", ErrInvalidDocument)
+	}
+
+	var header []byte
+	for len(rest) > 0 {
+		var line []byte
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+		if bytes.Equal(bytes.TrimSpace(line), frontmatterDelimiter) {
+			return header, rest, nil
+		}
+		header = append(header, line...)
+		header = append(header, '\n')
+	}
+	return nil, nil, fmt.Errorf("%w: unterminated frontmatter", ErrInvalidDocument)
+}
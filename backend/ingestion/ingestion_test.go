@@ -0,0 +1,46 @@
+package ingestion
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]struct {
+		raw       string
+		date      string
+		published bool
+		body      string
+		err       bool
+	}{
+		"plain":             {raw: "---\ntitle: Hello\ndate: \"2024-01-05\"\npublished: true\n---\n# Hello\n", date: "2024-01-05", published: true, body: "# Hello\n"},
+		"byte order mark":   {raw: "\ufeff---\ntitle: Hello\ndate: \"2024-01-05\"\n---\nbody", date: "2024-01-05", body: "body"},
+		"crlf":              {raw: "---\r\ntitle: Hello\r\ndate: \"2024-01-05\"\r\n---\r\nline one\r\nline two", date: "2024-01-05", body: "line one\nline two"},
+		"yaml date":         {raw: "---\ntitle: Hello\ndate: 2024-01-05\n---\n", date: "2024-01-05"},
+		"yaml timestamp":    {raw: "---\ntitle: Hello\ndate: 2024-01-05T10:30:00Z\n---\n", date: "2024-01-05T10:30:00Z"},
+		"unpublished":       {raw: "---\ntitle: Hello\ndate: \"2024-01-05\"\npublished: false\n---\n", date: "2024-01-05"},
+		"delimiter in body": {raw: "---\ntitle: Hello\ndate: \"2024-01-05\"\n---\nabove\n---\nbelow", date: "2024-01-05", body: "above\n---\nbelow"},
+		"missing delimiter": {raw: "title: Hello\ndate: 2024-01-05\n", err: true},
+		"unterminated":      {raw: "---\ntitle: Hello\ndate: 2024-01-05\n", err: true},
+		"missing title":     {raw: "---\ndate: 2024-01-05\n---\n", err: true},
+		"missing date":      {raw: "---\ntitle: Hello\n---\n", err: true},
+		"series no order":   {raw: "---\ntitle: Hello\ndate: 2024-01-05\nseries: Go\n---\n", err: true},
+		"invalid yaml":      {raw: "---\ntitle: [Hello\n---\n", err: true},
+	}
+	for name, tc := range cases {
+		document, err := Parse("hello", []byte(tc.raw))
+		if tc.err {
+			if !errors.Is(err, ErrInvalidDocument) {
+				t.Errorf("%s: expected ErrInvalidDocument, got %v", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+			continue
+		}
+		if document.Frontmatter.Date != tc.date || document.Frontmatter.Published != tc.published || document.Body != tc.body {
+			t.Errorf("%s: unexpected date %q, published %t, body %q", name, document.Frontmatter.Date, document.Frontmatter.Published, document.Body)
+		}
+	}
+}
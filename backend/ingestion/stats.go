@@ -0,0 +1,101 @@
+package ingestion
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// wordsPerMinute is the reading speed used to estimate reading time
+const wordsPerMinute = 200
+
+var (
+	headingPattern    = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+	jsxTagPattern     = regexp.MustCompile(`</?[A-Za-z][^>]*>`)
+	linkTargetPattern = regexp.MustCompile(`\]\([^)]*\)`)
+	inlineMarkPattern = regexp.MustCompile("[`*_~\\[\\]]")
+)
+
+// Heading is a markdown heading of the body, ID matches the anchor rehype-slug renders
+type Heading struct {
+	Depth int
+	Title string
+	ID    string
+}
+
+// Stats are the metadata derived from a post body
+type Stats struct {
+	WordCount   int
+	ReadingTime int // minutes, rounded up
+	Headings    []Heading
+}
+
+// Analyze counts the prose words of an MDX body, estimates its reading time and extracts its headings,
+// fenced code blocks and JSX tags are left out
+func Analyze(body string) Stats {
+	var stats Stats
+	ids := map[string]int{}
+	inFence := false
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		text := cleanInline(jsxTagPattern.ReplaceAllString(trimmed, " "))
+		if match := headingPattern.FindStringSubmatch(trimmed); match != nil {
+			title := cleanInline(match[2])
+			stats.Headings = append(stats.Headings, Heading{
+				Depth: len(match[1]),
+				Title: title,
+				ID:    uniqueID(ids, title),
+			})
+			text = title
+		}
+		stats.WordCount += countWords(text)
+	}
+	if stats.WordCount > 0 {
+		stats.ReadingTime = (stats.WordCount + wordsPerMinute - 1) / wordsPerMinute
+	}
+	return stats
+}
+
+// cleanInline drops link targets and inline markdown markers, keeping the visible text
+func cleanInline(text string) string {
+	text = linkTargetPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(inlineMarkPattern.ReplaceAllString(text, ""))
+}
+
+func countWords(text string) int {
+	count := 0
+	for _, field := range strings.Fields(text) {
+		if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// uniqueID slugs a heading the way github-slugger does, suffixing repeated slugs with -1, -2...
+func uniqueID(seen map[string]int, title string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_':
+			builder.WriteRune(r)
+		case r == ' ':
+			builder.WriteRune('-')
+		}
+	}
+	id := builder.String()
+	count, ok := seen[id]
+	seen[id] = count + 1
+	if ok {
+		return fmt.Sprintf("%s-%d", id, count)
+	}
+	return id
+}
@@ -0,0 +1,58 @@
+package ingestion
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeWordCount(t *testing.T) {
+	cases := map[string]struct {
+		body        string
+		words       int
+		readingTime int
+	}{
+		"empty":        {"", 0, 0},
+		"prose":        {"Hello **bold** world, [a link](https://example.com).", 5, 1},
+		"code fence":   {"one two\n```go\nfunc main() { fmt.Println(\"skipped\") }\n```\nthree", 3, 1},
+		"tilde fence":  {"one\n~~~\nskipped words here\n~~~\ntwo", 2, 1},
+		"jsx":          {"<Callout type=\"info\">\nInside the callout\n</Callout>", 3, 1},
+		"punctuation":  {"a - b — c", 3, 1},
+		"one minute":   {strings.Repeat("word ", 200), 200, 1},
+		"rounds up":    {strings.Repeat("word ", 201), 201, 2},
+		"crlf":         {"one\r\n```\r\nskipped\r\n```\r\ntwo", 2, 1},
+		"heading text": {"## Getting started\nbody", 3, 1},
+	}
+	for name, tc := range cases {
+		stats := Analyze(tc.body)
+		if stats.WordCount != tc.words || stats.ReadingTime != tc.readingTime {
+			t.Errorf("%s: expected %d words in %d min, got %d in %d", name, tc.words, tc.readingTime, stats.WordCount, stats.ReadingTime)
+		}
+	}
+}
+
+func TestAnalyzeHeadings(t *testing.T) {
+	body := strings.Join([]string{
+		"# Introduction",
+		"## Setup",
+		"### Installing `go`",
+		"## Setup",
+		"```md",
+		"## Not a heading",
+		"```",
+		"#### [Linked](https://example.com) heading ##",
+		"#NoSpace isn't a heading",
+		"## Setup",
+	}, "\n")
+	want := []Heading{
+		{Depth: 1, Title: "Introduction", ID: "introduction"},
+		{Depth: 2, Title: "Setup", ID: "setup"},
+		{Depth: 3, Title: "Installing go", ID: "installing-go"},
+		{Depth: 2, Title: "Setup", ID: "setup-1"},
+		{Depth: 4, Title: "Linked heading", ID: "linked-heading"},
+		{Depth: 2, Title: "Setup", ID: "setup-2"},
+	}
+	if got := Analyze(body).Headings; !slices.Equal(got, want) {
+		t.Errorf("unexpected headings %+v", got)
+	}
+}
@@ -5,19 +5,21 @@ import (
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
 )
 
-func NewOtelProviders(ctx context.Context) (*trace.TracerProvider, *log.LoggerProvider, error) {
+func NewOtelProviders(ctx context.Context) (*trace.TracerProvider, *log.LoggerProvider, *metric.MeterProvider, error) {
 	tracerProvider, err := newTracerProvider(ctx)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	otel.SetTracerProvider(tracerProvider)
@@ -26,10 +28,15 @@ func NewOtelProviders(ctx context.Context) (*trace.TracerProvider, *log.LoggerPr
 	)
 	loggerProvider, err := newLoggerProvider(ctx)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	global.SetLoggerProvider(loggerProvider)
-	return tracerProvider, loggerProvider, nil
+	meterProvider, err := newMeterProvider(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	otel.SetMeterProvider(meterProvider)
+	return tracerProvider, loggerProvider, meterProvider, nil
 }
 
 func newTracerProvider(ctx context.Context) (*trace.TracerProvider, error) {
@@ -72,3 +79,17 @@ func newLoggerProvider(ctx context.Context) (*log.LoggerProvider, error) {
 	)
 	return provider, nil
 }
+
+func newMeterProvider(ctx context.Context) (*metric.MeterProvider, error) {
+	exporter, err := otlpmetricgrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider := metric.NewMeterProvider(
+		metric.WithReader(metric.NewPeriodicReader(exporter)),
+		metric.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+		)),
+	)
+	return provider, nil
+}
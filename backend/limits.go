@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxLimit is the page size cap of any route without an explicit maximum
+const defaultMaxLimit = 6
+
+// RouteLimits holds the maximum page size accepted by each paginated route, keyed by route path
+type RouteLimits map[string]int
+
+// NewRouteLimits reads ROUTE_MAX_LIMITS, a comma separated list of route=max pairs
+// e.g. "/blog/posts=24", invalid entries are logged and ignored
+func NewRouteLimits() RouteLimits {
+	limits := RouteLimits{}
+	config := os.Getenv("ROUTE_MAX_LIMITS")
+	if config == "" {
+		return limits
+	}
+	for _, entry := range strings.Split(config, ",") {
+		route, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		maxLimit, err := strconv.Atoi(value)
+		if !found || err != nil || maxLimit < 1 {
+			slog.Warn("Ignoring invalid ROUTE_MAX_LIMITS entry", "Entry", entry)
+			continue
+		}
+		limits[route] = maxLimit
+	}
+	return limits
+}
+
+// Max returns the maximum page size of a route, limits of legacy paths also apply to the current version
+func (l RouteLimits) Max(route string) int {
+	if maxLimit, ok := l[route]; ok {
+		return maxLimit
+	}
+	if maxLimit, ok := l[unversionedRoute(route)]; ok {
+		return maxLimit
+	}
+	return defaultMaxLimit
+}
@@ -10,8 +10,8 @@ import (
 	aws "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
-	"github.com/gin-gonic/gin"
 	slogmulti "github.com/samber/slog-multi"
 	"go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
@@ -20,12 +20,13 @@ import (
 func main() {
 	ctx := context.Background()
 	// Initialize OpenTelemetry providers
-	traceProvider, loggerProvider, err := NewOtelProviders(ctx)
+	traceProvider, loggerProvider, meterProvider, err := NewOtelProviders(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer traceProvider.Shutdown(ctx)
 	defer loggerProvider.Shutdown(ctx)
+	defer meterProvider.Shutdown(ctx)
 	// Initialize the logger
 	consoleSlogHandler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{AddSource: true})
 	otelSlogHandler := otelslog.NewHandler(os.Getenv("PROD_DOMAIN"), otelslog.WithLoggerProvider(loggerProvider))
@@ -44,26 +45,16 @@ func main() {
 	// Initialize the BlogRepository
 	parameterStore := ssm.NewFromConfig(awsConfig)
 	cdn := cloudfront.NewFromConfig(awsConfig)
-	blogRepository, err := NewBlogRepository(ctx, db, tableName, cdn, parameterStore)
+	queue := sqs.NewFromConfig(awsConfig)
+	blogRepository, err := NewBlogRepository(ctx, db, tableName, cdn, queue, parameterStore)
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to initialize BlogRepository", "Error", err)
 		log.Fatal(err)
 	}
 	// Initialize the BlogController
-	blogController := NewBlogController(db, tableName, migration, blogRepository)
-	router := gin.New()
-	// Register Global middlewares
-	router.Use(OtelGinMiddleware())
-	slog.InfoContext(ctx, "Allowed origins", "Origins", os.Getenv("ALLOWED_ORIGINS"))
-	//router.Use(CorsMiddleware(strings.Split(os.Getenv("ALLOWED_ORIGINS"), ","))) //todo: understand why duplicate cors headers are being sent
-	router.Use(CdnCacheMiddleware())
-	// Register endpoints
-	router.GET("/blog/posts", blogController.GetPostsHandler)
-	router.GET("/blog/tags", blogController.GetTagsHandler)
-	router.PUT("/blog/posts", blogController.UpsertPostHandler)
-	router.POST("/blog/events/posts-updated", GcpPubSubAuthMiddleware(), blogController.PostsUpdatedGcpSubscriptionHandler)
-	router.DELETE("/blog/posts/:slug", blogController.DeletePostHandler)
-	router.POST("/blog/hardsync", blogController.HardSyncHandler)
+	blogController := NewBlogController(db, tableName, migration, blogRepository, NewRouteLimits())
+	RegisterBindingFieldNames()
+	router := NewRouter(blogController)
 
 	router.Run()
 }
@@ -59,7 +59,7 @@ func (m *Migration) Up(ctx context.Context) error {
 			},
 			{
 				AttributeName: aws.String("SK_LSI2"),
-				AttributeType: types.ScalarAttributeTypeN,
+				AttributeType: types.ScalarAttributeTypeS,
 			},
 			{
 				AttributeName: aws.String("SK_LSI3"),
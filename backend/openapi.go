@@ -0,0 +1,361 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const openapiVersion = "3.0.3"
+
+// OpenAPIDocument is the OpenAPI 3 description of the blog API, generated from the route table
+type OpenAPIDocument struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       OpenAPIInfo                     `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"` // path, then lowercase method
+	Components OpenAPIComponents               `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"` // path or query
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON schema the DTOs need
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// openapiSecuritySchemes are the schemes a Route can require through its Security field
+var openapiSecuritySchemes = map[string]SecurityScheme{
+	"gcpPubSub": {
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "Google signed OIDC token of the Pub/Sub push subscription",
+	},
+}
+
+var ginPathParamPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// openapiPath turns a gin path into an OpenAPI path e.g. /blog/posts/:slug into /blog/posts/{slug}
+func openapiPath(path string) string {
+	return ginPathParamPattern.ReplaceAllString(path, "{$1}")
+}
+
+// NewOpenAPIDocument describes the routes, DTOs become component schemas named after their Go type,
+// query parameters are read from the form and binding tags of the Query struct and
+// limit maximums from the route limits
+func NewOpenAPIDocument(routes []Route, limits RouteLimits) *OpenAPIDocument {
+	schemas := schemaRegistry{}
+	document := &OpenAPIDocument{
+		OpenAPI: openapiVersion,
+		Info:    OpenAPIInfo{Title: "Cloudificando blog API", Version: "1.0.0"},
+		Paths:   map[string]map[string]Operation{},
+		Components: OpenAPIComponents{
+			Schemas:         schemas,
+			SecuritySchemes: openapiSecuritySchemes,
+		},
+	}
+	problem := map[string]MediaType{"application/problem+json": {Schema: schemas.schemaOf(reflect.TypeOf(RestError{}))}}
+	for _, route := range routes {
+		operation := Operation{
+			OperationID: route.OperationID,
+			Summary:     route.Summary,
+			Deprecated:  route.Deprecated,
+			Responses: map[string]Response{
+				"200":     {Description: "OK", Content: mediaType(route.ResponseType, schemas.schemaOf(reflect.TypeOf(route.Response)))},
+				"default": {Description: "Problem details of the error", Content: problem},
+			},
+		}
+		for _, match := range ginPathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+			operation.Parameters = append(operation.Parameters, Parameter{
+				Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"},
+			})
+		}
+		if route.Query != nil {
+			operation.Parameters = append(operation.Parameters, schemas.queryParameters(reflect.TypeOf(route.Query), limits.Max(route.Path))...)
+		}
+		if route.Body != nil {
+			operation.RequestBody = &RequestBody{
+				Required: true,
+				Content:  mediaType(route.BodyType, schemas.schemaOf(reflect.TypeOf(route.Body))),
+			}
+		}
+		if route.Security != "" {
+			operation.Security = []map[string][]string{{route.Security: {}}}
+		}
+		path := openapiPath(route.Path)
+		if document.Paths[path] == nil {
+			document.Paths[path] = map[string]Operation{}
+		}
+		document.Paths[path][strings.ToLower(route.Method)] = operation
+	}
+	return document
+}
+
+func mediaType(contentType string, schema *Schema) map[string]MediaType {
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	return map[string]MediaType{contentType: {Schema: schema}}
+}
+
+// schemaRegistry collects the component schemas of named structs as they are referenced
+type schemaRegistry map[string]*Schema
+
+func (sr schemaRegistry) schemaOf(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(sr.schemaOf(t.Elem()))
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: sr.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: sr.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sr.structSchema(t)
+		}
+		if _, ok := sr[t.Name()]; !ok {
+			sr[t.Name()] = &Schema{} // placeholder so recursive types like TocItem terminate
+			sr[t.Name()] = sr.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	default:
+		return &Schema{}
+	}
+}
+
+// structSchema maps exported fields by their json name, fields are required when bound as required
+// or always serialized, optional slices, maps and pointers may be null
+func (sr schemaRegistry) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, field := range fields(t) {
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := sr.schemaOf(field.Type)
+		rules := bindingRules(field)
+		applyBindingRules(property, field.Type, rules)
+		_, boundRequired := rules["required"]
+		if boundRequired || !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+		switch field.Type.Kind() {
+		case reflect.Slice, reflect.Map:
+			if !boundRequired {
+				property = nullable(property)
+			}
+		}
+		schema.Properties[name] = property
+	}
+	return schema
+}
+
+// queryParameters describes the fields of a query struct bound by their form tag
+func (sr schemaRegistry) queryParameters(t reflect.Type, maxLimit int) []Parameter {
+	var parameters []Parameter
+	for _, field := range fields(t) {
+		name, options, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		schema := sr.schemaOf(field.Type)
+		rules := bindingRules(field)
+		applyBindingRules(schema, field.Type, rules)
+		if name == "limit" {
+			schema.Maximum = float(maxLimit)
+		}
+		if value, ok := strings.CutPrefix(options, "default="); ok {
+			schema.Default = value
+			if number, err := strconv.Atoi(value); err == nil {
+				schema.Default = number
+			}
+		}
+		_, required := rules["required"]
+		parameters = append(parameters, Parameter{Name: name, In: "query", Required: required, Schema: schema})
+	}
+	return parameters
+}
+
+// fields returns the exported fields of a struct, flattening embedded structs like encoding/json
+func fields(t reflect.Type) []reflect.StructField {
+	var exported []reflect.StructField
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || (field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "") {
+			continue
+		}
+		exported = append(exported, field)
+	}
+	return exported
+}
+
+// bindingRules parses the binding tag of a field into rule, parameter pairs
+func bindingRules(field reflect.StructField) map[string]string {
+	rules := map[string]string{}
+	for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+		if rule == "" {
+			continue
+		}
+		name, param, _ := strings.Cut(rule, "=")
+		rules[name] = param
+	}
+	return rules
+}
+
+// applyBindingRules translates the validator rules the DTOs use into schema keywords
+func applyBindingRules(schema *Schema, t reflect.Type, rules map[string]string) {
+	for rule, param := range rules {
+		number, _ := strconv.Atoi(param)
+		switch rule {
+		case "min", "max":
+			bound := &number
+			switch t.Kind() {
+			case reflect.String:
+				if rule == "min" {
+					schema.MinLength = bound
+				} else {
+					schema.MaxLength = bound
+				}
+			case reflect.Slice, reflect.Array, reflect.Map:
+				if rule == "min" {
+					schema.MinItems = bound
+				} else {
+					schema.MaxItems = bound
+				}
+			default:
+				if rule == "min" {
+					schema.Minimum = float(number)
+				} else {
+					schema.Maximum = float(number)
+				}
+			}
+		case "oneof":
+			schema.Enum = strings.Fields(param)
+		case "datetime":
+			if param == "2006-01-02" {
+				schema.Format = "date"
+			} else {
+				schema.Format = "date-time"
+			}
+		}
+	}
+}
+
+// nullable allows null on a schema, wrapping references since siblings of $ref are ignored in OpenAPI 3.0
+func nullable(schema *Schema) *Schema {
+	if schema.Ref != "" {
+		return &Schema{AllOf: []*Schema{schema}, Nullable: true}
+	}
+	schema.Nullable = true
+	return schema
+}
+
+func float(value int) *float64 {
+	number := float64(value)
+	return &number
+}
+
+// OpenAPIHandler serves the OpenAPI document of the API
+func (bc *BlogController) OpenAPIHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, bc.openapi())
+}
+
+// docsPage renders the OpenAPI document with Redoc
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+	<title>Cloudificando blog API</title>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+	<redoc spec-url="openapi.json"></redoc>
+	<script src="https://cdn.redoc.ly/redoc/latest/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+// DocsHandler serves the API reference page
+func (bc *BlogController) DocsHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(docsPage))
+}
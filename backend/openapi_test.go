@@ -0,0 +1,142 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestController() *BlogController {
+	gin.SetMode(gin.TestMode)
+	return NewBlogController(nil, "", nil, nil, RouteLimits{})
+}
+
+// TestOpenAPIMatchesRouter fails when a route is served without being described in the spec or the other way around
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	bc := newTestController()
+	document := bc.openapi()
+	served := map[string]bool{}
+	for _, route := range NewRouter(bc).Routes() {
+		// the Connect service is described by its protobuf definition
+		if strings.HasPrefix(route.Path, connectPrefix+"/") {
+			continue
+		}
+		key := route.Method + " " + openapiPath(route.Path)
+		served[key] = true
+		if _, ok := document.Paths[openapiPath(route.Path)][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("%s is served but missing from the OpenAPI document", key)
+		}
+	}
+	for path, operations := range document.Paths {
+		for method := range operations {
+			key := strings.ToUpper(method) + " " + path
+			if !served[key] {
+				t.Errorf("%s is in the OpenAPI document but not served", key)
+			}
+		}
+	}
+}
+
+// TestMainRegistersRoutesThroughTable fails when main.go registers a route on the engine directly,
+// bypassing the route table the OpenAPI document is generated from
+func TestMainRegistersRoutesThroughTable(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registrations := map[string]bool{
+		"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true,
+		"HEAD": true, "OPTIONS": true, "Any": true, "Handle": true, "Group": true,
+	}
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if selector, ok := call.Fun.(*ast.SelectorExpr); ok && registrations[selector.Sel.Name] {
+			t.Errorf("main.go registers a route with %s, add it to BlogController.Routes instead", selector.Sel.Name)
+		}
+		return true
+	})
+}
+
+func TestOpenAPIDescribesDTOs(t *testing.T) {
+	document := newTestController().openapi()
+	for _, name := range []string{"Post", "ListPosts", "TagWithCount", "HardSyncRequest", "EventPostUpdatedRequest", "RestError"} {
+		if _, ok := document.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+	post := document.Components.Schemas["Post"]
+	if _, ok := post.Properties["body_sha256"]; ok {
+		t.Error("Post exposes fields hidden from JSON")
+	}
+	if !slices.Contains(post.Required, "slug") || slices.Contains(post.Required, "series") {
+		t.Errorf("unexpected required Post fields %v", post.Required)
+	}
+
+	var refs []string
+	var collect func(schema *Schema)
+	collect = func(schema *Schema) {
+		if schema == nil {
+			return
+		}
+		if schema.Ref != "" {
+			refs = append(refs, schema.Ref)
+		}
+		for _, nested := range schema.AllOf {
+			collect(nested)
+		}
+		for _, property := range schema.Properties {
+			collect(property)
+		}
+		collect(schema.Items)
+		collect(schema.AdditionalProperties)
+	}
+	for _, schema := range document.Components.Schemas {
+		collect(schema)
+	}
+	for _, operations := range document.Paths {
+		for _, operation := range operations {
+			for _, response := range operation.Responses {
+				for _, media := range response.Content {
+					collect(media.Schema)
+				}
+			}
+			if operation.RequestBody != nil {
+				for _, media := range operation.RequestBody.Content {
+					collect(media.Schema)
+				}
+			}
+		}
+	}
+	for _, ref := range refs {
+		if _, ok := document.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+			t.Errorf("unresolved reference %s", ref)
+		}
+	}
+}
+
+func TestOpenAPIQueryParameters(t *testing.T) {
+	bc := newTestController()
+	bc.limits = RouteLimits{"/blog/posts": 24}
+	parameters := map[string]Parameter{}
+	for _, parameter := range bc.openapi().Paths["/blog/posts"]["get"].Parameters {
+		parameters[parameter.Name] = parameter
+	}
+	limit := parameters["limit"].Schema
+	if limit == nil || limit.Maximum == nil || *limit.Maximum != 24 || limit.Default != 6 {
+		t.Errorf("unexpected limit schema %+v", limit)
+	}
+	if sort := parameters["sort"].Schema; sort == nil || len(sort.Enum) != 2 {
+		t.Errorf("unexpected sort schema %+v", sort)
+	}
+	if from := parameters["from"].Schema; from == nil || from.Format != "date" {
+		t.Errorf("unexpected from schema %+v", from)
+	}
+}
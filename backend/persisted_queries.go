@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoType "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// persistedQueryTTL is how long a registered query is kept, clients register it again once it expired
+	persistedQueryTTL = 30 * 24 * time.Hour
+	// persistedQueryCacheSize bounds the queries memoized per instance
+	persistedQueryCacheSize = 256
+	persistedQueryCacheTTL  = time.Hour
+)
+
+// errPersistedQueryNotFound keeps unknown hashes out of the cache, as errors aren't cached
+var errPersistedQueryNotFound = errors.New("persisted query not found")
+
+// PersistedQueries maps sha256 hashes to GraphQL queries so clients can send the hash alone over GET,
+// queries are stored in the table to survive cold starts and memoized per instance. Only clients holding one of
+// apiKeys can register queries, so anonymous clients can't fill the table
+type PersistedQueries struct {
+	repository *BlogRepository
+	cache      *ReadCache
+	apiKeys    []string
+}
+
+// NewPersistedQueriesFromEnv reads GRAPHQL_PERSIST_API_KEYS, the comma separated API keys allowed to register
+// queries with the X-API-Key header. Without keys no query can be registered
+func NewPersistedQueriesFromEnv(repository *BlogRepository) *PersistedQueries {
+	return &PersistedQueries{
+		repository: repository,
+		cache:      NewReadCache(persistedQueryCacheSize, persistedQueryCacheTTL),
+		apiKeys:    splitList(os.Getenv("GRAPHQL_PERSIST_API_KEYS")),
+	}
+}
+
+// CanRegister tells whether the API key is allowed to register queries
+func (pq *PersistedQueries) CanRegister(apiKey string) bool {
+	for _, key := range pq.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the query persisted under hash, or "" when there is none
+func (pq *PersistedQueries) Get(ctx context.Context, hash string) (string, error) {
+	query, err := cachedRead(ctx, pq.cache, persistedQuerySortKey(hash), func(ctx context.Context) (string, error) {
+		query, err := pq.repository.GetPersistedQuery(ctx, hash)
+		if err == nil && query == "" {
+			err = errPersistedQueryNotFound
+		}
+		return query, err
+	})
+	if errors.Is(err, errPersistedQueryNotFound) {
+		return "", nil
+	}
+	return query, err
+}
+
+// Put persists a query under its hash, for persistedQueryTTL
+func (pq *PersistedQueries) Put(ctx context.Context, hash, query string) error {
+	if cached, err := pq.Get(ctx, hash); err == nil && cached == query {
+		return nil
+	}
+	if err := pq.repository.PutPersistedQuery(ctx, hash, query, time.Now().Add(persistedQueryTTL)); err != nil {
+		return err
+	}
+	pq.cache.put(readCacheEntry{key: persistedQuerySortKey(hash), value: query}, pq.cache.currentGeneration())
+	return nil
+}
+
+// GetPersistedQuery returns the GraphQL query stored under hash, or "" when there is none
+func (r *BlogRepository) GetPersistedQuery(ctx context.Context, hash string) (string, error) {
+	result, err := r.Db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]dynamoType.AttributeValue{
+			"PK": &dynamoType.AttributeValueMemberS{Value: "PERSISTED_QUERY"},
+			"SK": &dynamoType.AttributeValueMemberS{Value: persistedQuerySortKey(hash)},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	query, ok := result.Item["query"].(*dynamoType.AttributeValueMemberS)
+	if !ok {
+		return "", nil
+	}
+	// expired items linger until DynamoDB's TTL sweep deletes them
+	if expires, ok := result.Item["expires_at"].(*dynamoType.AttributeValueMemberN); ok {
+		if seconds, err := strconv.ParseInt(expires.Value, 10, 64); err == nil && seconds <= time.Now().Unix() {
+			return "", nil
+		}
+	}
+	return query.Value, nil
+}
+
+// PutPersistedQuery stores a GraphQL query under its hash until expires, queries are immutable so registering
+// one again only extends it
+func (r *BlogRepository) PutPersistedQuery(ctx context.Context, hash, query string, expires time.Time) error {
+	_, err := r.Db.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item: map[string]dynamoType.AttributeValue{
+			"PK":         &dynamoType.AttributeValueMemberS{Value: "PERSISTED_QUERY"},
+			"SK":         &dynamoType.AttributeValueMemberS{Value: persistedQuerySortKey(hash)},
+			"query":      &dynamoType.AttributeValueMemberS{Value: query},
+			"Type":       &dynamoType.AttributeValueMemberS{Value: "PERSISTED_QUERY"},
+			"expires_at": &dynamoType.AttributeValueMemberN{Value: strconv.FormatInt(expires.Unix(), 10)},
+		},
+	})
+	return err
+}
+
+func persistedQuerySortKey(hash string) string {
+	return fmt.Sprintf("SHA256#%s", hash)
+}
+
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
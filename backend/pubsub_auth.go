@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	googleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+	// defaultJWKSMaxAge applies when Google's certs response has no max-age
+	defaultJWKSMaxAge = time.Hour
+	// minJWKSRefresh limits refreshes triggered by unknown key IDs, so forged tokens can't make us hammer Google
+	minJWKSRefresh = time.Minute
+	// tokenClockSkew is the tolerance of exp and iat checks
+	tokenClockSkew = time.Minute
+)
+
+// googleIssuers are the iss values of Google signed ID tokens
+var googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+// googleIDClaims are the claims of the ID token Pub/Sub sends with push requests
+type googleIDClaims struct {
+	Issuer        string `json:"iss"`
+	Audience      string `json:"aud"`
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	IssuedAt      int64  `json:"iat"`
+	Expires       int64  `json:"exp"`
+}
+
+// PubSubAuthenticator checks the Google signed OIDC token Pub/Sub push subscriptions send as a Bearer token:
+// its signature against Google's keys, issuer, audience, expiry and that it was issued to an allowed service account
+type PubSubAuthenticator struct {
+	audiences []string
+	emails    []string
+	keys      *JWKSCache
+	now       func() time.Time
+}
+
+// NewPubSubAuthenticatorFromEnv reads PUBSUB_AUDIENCES, the comma separated audiences accepted, defaulting to the
+// push endpoint on PROD_DOMAIN, and PUBSUB_SERVICE_ACCOUNTS, the emails of the service accounts allowed to push.
+// Without service accounts every push is rejected
+func NewPubSubAuthenticatorFromEnv() *PubSubAuthenticator {
+	auth := &PubSubAuthenticator{keys: NewJWKSCache(googleCertsURL), now: time.Now}
+	auth.audiences = splitList(os.Getenv("PUBSUB_AUDIENCES"))
+	if len(auth.audiences) == 0 {
+		auth.audiences = []string{"https://" + os.Getenv("PROD_DOMAIN") + legacyPrefix + "/events/posts-updated"}
+	}
+	auth.emails = splitList(os.Getenv("PUBSUB_SERVICE_ACCOUNTS"))
+	if len(auth.emails) == 0 && os.Getenv("ENVIRONMENT") != "dev" {
+		slog.Warn("PUBSUB_SERVICE_ACCOUNTS isn't set, Pub/Sub pushes will be rejected")
+	}
+	return auth
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Middleware rejects requests without a valid push token, authentication is skipped in dev
+func (a *PubSubAuthenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if os.Getenv("ENVIRONMENT") == "dev" {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		scheme, token, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			abortWithError(c, &UnauthorizedError{Message: "Missing Bearer token"})
+			return
+		}
+		claims, err := a.Verify(ctx, strings.TrimSpace(token))
+		var upstream *UpstreamError
+		if errors.As(err, &upstream) {
+			abortWithError(c, err)
+			return
+		}
+		if err != nil {
+			slog.InfoContext(ctx, "Rejected Pub/Sub push token", "Error", err)
+			abortWithError(c, &UnauthorizedError{Message: "Invalid ID token"})
+			return
+		}
+		slog.DebugContext(ctx, "Authenticated Pub/Sub push", "Email", claims.Email)
+		c.Next()
+	}
+}
+
+// Verify checks an RS256 signed ID token and returns its claims
+func (a *PubSubAuthenticator) Verify(ctx context.Context, token string) (*googleIDClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	if header.Algorithm != "RS256" {
+		return nil, fmt.Errorf("unexpected algorithm %q", header.Algorithm)
+	}
+	key, err := a.keys.Key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("invalid token signature")
+	}
+	var claims googleIDClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	now := a.now()
+	switch {
+	case !slices.Contains(googleIssuers, claims.Issuer):
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	case !slices.Contains(a.audiences, claims.Audience):
+		return nil, fmt.Errorf("unexpected audience %q", claims.Audience)
+	case now.After(time.Unix(claims.Expires, 0).Add(tokenClockSkew)):
+		return nil, errors.New("token expired")
+	case now.Add(tokenClockSkew).Before(time.Unix(claims.IssuedAt, 0)):
+		return nil, errors.New("token issued in the future")
+	case !claims.EmailVerified:
+		return nil, fmt.Errorf("email %q isn't verified", claims.Email)
+	case !slices.Contains(a.emails, claims.Email):
+		return nil, fmt.Errorf("service account %q isn't allowed to push", claims.Email)
+	}
+	return &claims, nil
+}
+
+func decodeTokenPart(part string, target any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// JWKSCache keeps the RSA keys of a JSON Web Key Set for as long as its response's max-age,
+// keys are refetched early when a token names an unknown key as Google rotates them
+type JWKSCache struct {
+	url     string
+	client  *http.Client
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	expires time.Time
+	fetched time.Time
+	now     func() time.Time
+}
+
+func NewJWKSCache(url string) *JWKSCache {
+	return &JWKSCache{url: url, client: &http.Client{Timeout: 10 * time.Second}, now: time.Now}
+}
+
+// Key returns the key with the given ID
+func (jc *JWKSCache) Key(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	now := jc.now()
+	key, ok := jc.keys[keyID]
+	if ok && now.Before(jc.expires) {
+		return key, nil
+	}
+	if now.Before(jc.expires) && now.Sub(jc.fetched) < minJWKSRefresh {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+	if err := jc.refresh(ctx, now); err != nil {
+		return nil, &UpstreamError{Service: "Google certs", Err: err}
+	}
+	if key, ok = jc.keys[keyID]; !ok {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+	return key, nil
+}
+
+func (jc *JWKSCache) refresh(ctx context.Context, now time.Time) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, jc.url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := jc.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	var set struct {
+		Keys []struct {
+			KeyType  string `json:"kty"`
+			KeyID    string `json:"kid"`
+			Modulus  string `json:"n"`
+			Exponent string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&set); err != nil {
+		return err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.KeyType != "RSA" {
+			continue
+		}
+		modulus, err := base64.RawURLEncoding.DecodeString(jwk.Modulus)
+		if err != nil {
+			return fmt.Errorf("malformed modulus of key %q: %w", jwk.KeyID, err)
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(jwk.Exponent)
+		if err != nil {
+			return fmt.Errorf("malformed exponent of key %q: %w", jwk.KeyID, err)
+		}
+		keys[jwk.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(new(big.Int).SetBytes(exponent).Int64())}
+	}
+	jc.keys = keys
+	jc.fetched = now
+	jc.expires = now.Add(cacheMaxAge(response.Header.Get("Cache-Control"), defaultJWKSMaxAge))
+	return nil
+}
+
+// cacheMaxAge reads the max-age directive of a Cache-Control header
+func cacheMaxAge(cacheControl string, fallback time.Duration) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		if value, found := strings.CutPrefix(strings.TrimSpace(directive), "max-age="); found {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeGoogleSigner issues ID tokens like Google does and serves its keys as a JWKS
+type fakeGoogleSigner struct {
+	key     *rsa.PrivateKey
+	keyID   string
+	fetches atomic.Int32
+	server  *httptest.Server
+}
+
+func newFakeGoogleSigner(t *testing.T) *fakeGoogleSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &fakeGoogleSigner{key: key, keyID: "fake-key"}
+	signer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signer.fetches.Add(1)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "alg": "RS256", "use": "sig", "kid": signer.keyID,
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(signer.server.Close)
+	return signer
+}
+
+func (s *fakeGoogleSigner) sign(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": s.keyID, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestPubSubAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("ENVIRONMENT", "production")
+	t.Setenv("PROD_DOMAIN", "api.cloudificando.com")
+	t.Setenv("PUBSUB_SERVICE_ACCOUNTS", "pusher@project.iam.gserviceaccount.com")
+	signer := newFakeGoogleSigner(t)
+	now := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	auth := NewPubSubAuthenticatorFromEnv()
+	auth.keys = NewJWKSCache(signer.server.URL)
+	auth.now = func() time.Time { return now }
+	auth.keys.now = auth.now
+	router := gin.New()
+	router.Use(ProblemMiddleware())
+	router.POST("/blog/events/posts-updated", auth.Middleware(), func(c *gin.Context) {
+		c.JSON(200, MessageResponse{Message: "ok"})
+	})
+	send := func(authorization string) int {
+		request := httptest.NewRequest("POST", "/blog/events/posts-updated", nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	claims := func(changes map[string]any) map[string]any {
+		claims := map[string]any{
+			"iss": "https://accounts.google.com", "aud": "https://api.cloudificando.com/blog/events/posts-updated",
+			"sub": "1234", "email": "pusher@project.iam.gserviceaccount.com", "email_verified": true,
+			"iat": now.Add(-time.Minute).Unix(), "exp": now.Add(time.Hour).Unix(),
+		}
+		for name, value := range changes {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	if code := send("Bearer " + signer.sign(t, signer.key, claims(nil))); code != 200 {
+		t.Errorf("expected a valid push to pass, got %d", code)
+	}
+	if code := send("bearer " + signer.sign(t, signer.key, claims(map[string]any{"iss": "accounts.google.com"}))); code != 200 {
+		t.Errorf("expected both Google issuers and any scheme case to pass, got %d", code)
+	}
+	forger, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rejected := map[string]string{
+		"no header":        "",
+		"no Bearer prefix": signer.sign(t, signer.key, claims(nil)),
+		"empty token":      "Bearer ",
+		"malformed token":  "Bearer not.a-token",
+		"forged signature": "Bearer " + signer.sign(t, forger, claims(nil)),
+		"other audience":   "Bearer " + signer.sign(t, signer.key, claims(map[string]any{"aud": "https://evil.io/push"})),
+		"other issuer":     "Bearer " + signer.sign(t, signer.key, claims(map[string]any{"iss": "https://evil.io"})),
+		"other account":    "Bearer " + signer.sign(t, signer.key, claims(map[string]any{"email": "someone@gmail.com"})),
+		"unverified email": "Bearer " + signer.sign(t, signer.key, claims(map[string]any{"email_verified": false})),
+		"expired":          "Bearer " + signer.sign(t, signer.key, claims(map[string]any{"exp": now.Add(-time.Hour).Unix()})),
+	}
+	for name, authorization := range rejected {
+		if code := send(authorization); code != 401 {
+			t.Errorf("%s: expected 401, got %d", name, code)
+		}
+	}
+	if fetches := signer.fetches.Load(); fetches != 1 {
+		t.Errorf("expected the keys to be fetched once, got %d", fetches)
+	}
+
+	signer.keyID = "rotated-key"
+	now = now.Add(2 * minJWKSRefresh)
+	if code := send("Bearer " + signer.sign(t, signer.key, claims(nil))); code != 200 {
+		t.Errorf("expected rotated keys to be refetched, got %d", code)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	if got := cacheMaxAge("public, max-age=22367, must-revalidate, no-transform", time.Hour); got != 22367*time.Second {
+		t.Errorf("unexpected max-age %v", got)
+	}
+	if got := cacheMaxAge("no-cache", time.Hour); got != time.Hour {
+		t.Errorf("expected the fallback, got %v", got)
+	}
+}
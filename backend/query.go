@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultPageSize is the number of posts listed when no limit is given, the limit form default must match it
+const defaultPageSize = 6
+
+// ListPostsQuery are the query parameters of the posts listing
+type ListPostsQuery struct {
+	Limit  int    `form:"limit,default=6" binding:"min=1"`
+	Cursor string `form:"cursor" binding:"max=1024"`
+	Tag    string `form:"tag" binding:"max=40"`
+	Sort   string `form:"sort,default=desc" binding:"oneof=asc desc"`
+	From   string `form:"from" binding:"omitempty,datetime=2006-01-02"` // inclusive, by created_at
+	To     string `form:"to" binding:"omitempty,datetime=2006-01-02"`   // inclusive, by created_at
+	Count  bool   `form:"count"`
+}
+
+// Validate normalizes the query and checks the rules binding tags can't express
+func (q *ListPostsQuery) Validate(maxLimit int) []FieldError {
+	var errs []FieldError
+	q.Tag = normalizeQueryTag(q.Tag)
+	if q.Limit > maxLimit {
+		errs = append(errs, FieldError{Field: "limit", Message: fmt.Sprintf("must be at most %d", maxLimit)})
+	}
+	if q.From != "" && q.To != "" && q.From > q.To {
+		errs = append(errs, FieldError{Field: "from", Message: "must not be after to"})
+	}
+	return errs
+}
+
+// CursorQuery returns the parameters the cursors of this listing are bound to
+func (q *ListPostsQuery) CursorQuery() CursorQuery {
+	return CursorQuery{Tag: q.Tag, Sort: q.Sort, Limit: q.Limit, From: q.From, To: q.To}
+}
+
+// cacheableListing tells whether a page of posts may be cached at the CDN. Date ranges, page sizes other than
+// the default and tags without posts take arbitrary values, recording their paths would grow the surrogate key
+// index without bound
+func cacheableListing(query ListPostsQuery, page *ListPosts) bool {
+	return query.From == "" && query.To == "" && query.Limit == defaultPageSize && (query.Tag == "" || len(page.Items) > 0)
+}
+
+// NeighboursQuery are the query parameters of the post neighbours lookup
+type NeighboursQuery struct {
+	Tag string `form:"tag" binding:"max=40"`
+}
+
+// Validate normalizes the query, the neighbours lookup isn't paginated so maxLimit is unused
+func (q *NeighboursQuery) Validate(maxLimit int) []FieldError {
+	q.Tag = normalizeQueryTag(q.Tag)
+	return nil
+}
+
+// listQuery is implemented by the query parameter structs of list endpoints
+type listQuery interface {
+	Validate(maxLimit int) []FieldError
+}
+
+// bindListQuery binds and validates the query string against the limits of the matched route,
+// on failure it aborts with a validation error and returns false
+func (bc *BlogController) bindListQuery(c *gin.Context, query listQuery) bool {
+	if err := c.ShouldBindQuery(query); err != nil {
+		bindingError := NewBindingError(err)
+		// values that failed a rule are still bound, so report the remaining rules along with them
+		if len(bindingError.Fields) > 0 {
+			bindingError.Fields = append(bindingError.Fields, query.Validate(bc.limits.Max(c.FullPath()))...)
+		}
+		abortWithError(c, bindingError)
+		return false
+	}
+	if fieldErrors := query.Validate(bc.limits.Max(c.FullPath())); len(fieldErrors) > 0 {
+		abortWithError(c, NewValidationError(fieldErrors))
+		return false
+	}
+	return true
+}
+
+// normalizeQueryTag applies the tag normalization of stored posts so ?tag=Go matches "go"
+func normalizeQueryTag(tag string) string {
+	if normalized := normalizeTags([]string{tag}); len(normalized) > 0 {
+		return normalized[0]
+	}
+	return ""
+}
+
+// createdAtRange returns the LSI1 sort key bounds of an inclusive date range,
+// the upper bound is the day after to so every post of that day sorts before it
+func createdAtRange(from, to string) (string, string, error) {
+	var lower, upper string
+	if from != "" {
+		lower = "CREATED_AT#" + from
+	}
+	if to != "" {
+		day, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return "", "", err
+		}
+		upper = "CREATED_AT#" + day.AddDate(0, 0, 1).Format(time.DateOnly)
+	}
+	return lower, upper, nil
+}
+
+// queryNames returns the names of the query parameters a query struct binds
+func queryNames(query any) []string {
+	if query == nil {
+		return nil
+	}
+	var names []string
+	for _, field := range fields(reflect.TypeOf(query)) {
+		if name, _, _ := strings.Cut(field.Tag.Get("form"), ","); name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
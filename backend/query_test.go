@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestListPostsQueryDefaultLimit(t *testing.T) {
+	field, _ := reflect.TypeOf(ListPostsQuery{}).FieldByName("Limit")
+	if !strings.Contains(field.Tag.Get("form"), "default="+strconv.Itoa(defaultPageSize)) {
+		t.Errorf("expected the limit form default to be defaultPageSize %d, got %q", defaultPageSize, field.Tag.Get("form"))
+	}
+}
+
+func TestBindListQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	RegisterBindingFieldNames()
+	controller := &BlogController{limits: RouteLimits{"/posts": 10}}
+	router := gin.New()
+	router.Use(ProblemMiddleware())
+	router.GET("/posts", func(c *gin.Context) {
+		var query ListPostsQuery
+		if controller.bindListQuery(c, &query) {
+			c.JSON(200, query)
+		}
+	})
+	router.GET("/neighbours", func(c *gin.Context) {
+		var query NeighboursQuery
+		if controller.bindListQuery(c, &query) {
+			c.JSON(200, query)
+		}
+	})
+
+	cases := map[string]struct {
+		target string
+		want   any      // the bound query, on success
+		fields []string // the offending fields, on failure
+	}{
+		"defaults":           {target: "/posts", want: ListPostsQuery{Limit: defaultPageSize, Sort: SortDesc}},
+		"normalized tag":     {target: "/posts?limit=10&tag=Go&sort=asc", want: ListPostsQuery{Limit: 10, Tag: "go", Sort: SortAsc}},
+		"date range":         {target: "/posts?from=2024-01-01&to=2024-01-31&count=true", want: ListPostsQuery{Limit: defaultPageSize, Sort: SortDesc, From: "2024-01-01", To: "2024-01-31", Count: true}},
+		"over the route max": {target: "/posts?limit=11", fields: []string{"limit"}},
+		"zero limit":         {target: "/posts?limit=0", fields: []string{"limit"}},
+		"unknown sort":       {target: "/posts?sort=up", fields: []string{"sort"}},
+		"invalid date":       {target: "/posts?from=2024-13-01", fields: []string{"from"}},
+		"reversed range":     {target: "/posts?from=2024-02-01&to=2024-01-01", fields: []string{"from"}},
+		"every rule":         {target: "/posts?limit=0&from=2024-02-01&to=2024-01-01", fields: []string{"limit", "from"}},
+		"neighbours tag":     {target: "/neighbours?tag=Go", want: NeighboursQuery{Tag: "go"}},
+		"long tag":           {target: "/neighbours?tag=" + strings.Repeat("a", 41), fields: []string{"tag"}},
+	}
+	for name, tc := range cases {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", tc.target, nil))
+		if tc.fields == nil {
+			wanted, _ := json.Marshal(tc.want)
+			if recorder.Code != 200 || recorder.Body.String() != string(wanted) {
+				t.Errorf("%s: expected %s, got %d %s", name, wanted, recorder.Code, recorder.Body.String())
+			}
+			continue
+		}
+		var problem RestError
+		_ = json.Unmarshal(recorder.Body.Bytes(), &problem)
+		var fields []string
+		for _, field := range problem.Errors {
+			fields = append(fields, field.Field)
+		}
+		if recorder.Code != 400 || !slices.Equal(fields, tc.fields) {
+			t.Errorf("%s: expected a 400 on %v, got %d %s", name, tc.fields, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestCacheableListing(t *testing.T) {
+	page := &ListPosts{Items: []Post{{Slug: "hello"}}}
+	cases := map[string]struct {
+		query     ListPostsQuery
+		page      *ListPosts
+		cacheable bool
+	}{
+		"first page":         {query: ListPostsQuery{Limit: defaultPageSize}, page: page, cacheable: true},
+		"known tag":          {query: ListPostsQuery{Limit: defaultPageSize, Tag: "go"}, page: page, cacheable: true},
+		"later page":         {query: ListPostsQuery{Limit: defaultPageSize, Cursor: "signed"}, page: &ListPosts{}, cacheable: true},
+		"tag without posts":  {query: ListPostsQuery{Limit: defaultPageSize, Tag: "random"}, page: &ListPosts{}},
+		"other page size":    {query: ListPostsQuery{Limit: defaultPageSize - 1}, page: page},
+		"date range":         {query: ListPostsQuery{Limit: defaultPageSize, From: "2024-01-01"}, page: page},
+		"open ended to date": {query: ListPostsQuery{Limit: defaultPageSize, To: "2024-01-01"}, page: page},
+	}
+	for name, tc := range cases {
+		if got := cacheableListing(tc.query, tc.page); got != tc.cacheable {
+			t.Errorf("%s: expected cacheable %t, got %t", name, tc.cacheable, got)
+		}
+	}
+}
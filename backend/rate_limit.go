@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoType "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// Route classes sharing a rate limit budget, see Route.RateLimitClass
+const (
+	readRateLimit  = "read"
+	writeRateLimit = "write"
+	syncRateLimit  = "sync"
+)
+
+// RateLimit is a token bucket refilled with Rate tokens per second up to Burst, each request spends a token
+type RateLimit struct {
+	Rate  float64
+	Burst float64
+}
+
+// defaultRateLimits are the budgets of each client per route class, RATE_LIMITS overrides them
+var defaultRateLimits = map[string]RateLimit{
+	readRateLimit:  {Rate: 10, Burst: 100},
+	writeRateLimit: {Rate: 1, Burst: 20},
+	syncRateLimit:  {Rate: 1.0 / 600, Burst: 2},
+}
+
+// TooManyRequestsError is returned when a client spent its budget, RetryAfter is when a token is available again
+type TooManyRequestsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyRequestsError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry in %s", e.RetryAfter)
+}
+
+// RateLimitStore keeps the token buckets, stores fail open as an unavailable store shouldn't take the API down
+type RateLimitStore interface {
+	// Take spends a token from the bucket of key, a missing bucket starts full. When the bucket is empty it
+	// returns false and how long until a token is available
+	Take(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error)
+}
+
+// RateLimiter limits the requests of each client per route class. Clients are identified by their API key
+// when it's one of RATE_LIMIT_API_KEYS, so trusted automation gets its own budget, by their IP otherwise.
+// Requests without a trusted client address aren't limited, see clientIP
+type RateLimiter struct {
+	store       RateLimitStore
+	limits      map[string]RateLimit
+	apiKeys     []string
+	ipHeader    string
+	proxySecret string
+}
+
+const (
+	// defaultClientIPHeader is where Cloudflare, proxying the API domain, sends the client address
+	defaultClientIPHeader = "CF-Connecting-IP"
+	// proxySecretHeader carries RATE_LIMIT_PROXY_SECRET, set by a Cloudflare transform rule to prove the
+	// request went through Cloudflare, anyone can reach CloudFront directly and set ipHeader themselves
+	proxySecretHeader = "X-Origin-Secret"
+	// viewerAddressHeader is the address CloudFront saw the request from, as ip:port
+	viewerAddressHeader = "CloudFront-Viewer-Address"
+)
+
+// NewRateLimiterFromEnv reads RATE_LIMIT_STORE, "memory" (default) for per instance buckets, "dynamodb" for buckets
+// shared by every instance in the RATE_LIMIT_TABLE_NAME table or "none" to disable limiting, RATE_LIMITS, a comma
+// separated list of class=count/period:burst e.g. "read=600/1m:100,sync=2/1h:2", RATE_LIMIT_API_KEYS,
+// RATE_LIMIT_IP_HEADER, the header holding the client address, and RATE_LIMIT_PROXY_SECRET, the secret the proxy
+// sends along it
+func NewRateLimiterFromEnv(repository *BlogRepository) *RateLimiter {
+	var store RateLimitStore
+	switch value := os.Getenv("RATE_LIMIT_STORE"); value {
+	case "none":
+		return nil
+	case "dynamodb":
+		// buckets are written on every request, they'd take the blog table's provisioned capacity
+		if table := os.Getenv("RATE_LIMIT_TABLE_NAME"); table != "" {
+			store = &DynamoRateLimitStore{repository: repository, table: table}
+			break
+		}
+		slog.Warn("RATE_LIMIT_TABLE_NAME isn't set, using in memory rate limit buckets")
+		store = NewMemoryRateLimitStore()
+	default:
+		if value != "" && value != "memory" {
+			slog.Warn("Ignoring invalid RATE_LIMIT_STORE", "Value", value)
+		}
+		store = NewMemoryRateLimitStore()
+	}
+	limiter := &RateLimiter{store: store, limits: map[string]RateLimit{}, ipHeader: defaultClientIPHeader}
+	if header := os.Getenv("RATE_LIMIT_IP_HEADER"); header != "" {
+		limiter.ipHeader = header
+	}
+	limiter.proxySecret = os.Getenv("RATE_LIMIT_PROXY_SECRET")
+	for class, limit := range defaultRateLimits {
+		limiter.limits[class] = limit
+	}
+	if config := os.Getenv("RATE_LIMITS"); config != "" {
+		for _, entry := range strings.Split(config, ",") {
+			class, limit, err := parseRateLimit(strings.TrimSpace(entry))
+			if err != nil {
+				slog.Warn("Ignoring invalid RATE_LIMITS entry", "Entry", entry, "Error", err)
+				continue
+			}
+			limiter.limits[class] = limit
+		}
+	}
+	for _, key := range strings.Split(os.Getenv("RATE_LIMIT_API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			limiter.apiKeys = append(limiter.apiKeys, key)
+		}
+	}
+	return limiter
+}
+
+// parseRateLimit parses a class=count/period:burst entry
+func parseRateLimit(entry string) (string, RateLimit, error) {
+	class, budget, found := strings.Cut(entry, "=")
+	if !found || class == "" {
+		return "", RateLimit{}, fmt.Errorf("expected class=count/period:burst")
+	}
+	rate, burst, found := strings.Cut(budget, ":")
+	count, period, _ := strings.Cut(rate, "/")
+	requests, err := strconv.ParseFloat(count, 64)
+	if err != nil || requests <= 0 {
+		return "", RateLimit{}, fmt.Errorf("invalid count %q", count)
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration <= 0 {
+		return "", RateLimit{}, fmt.Errorf("invalid period %q", period)
+	}
+	limit := RateLimit{Rate: requests / duration.Seconds(), Burst: requests}
+	if found {
+		if limit.Burst, err = strconv.ParseFloat(burst, 64); err != nil || limit.Burst < 1 {
+			return "", RateLimit{}, fmt.Errorf("invalid burst %q", burst)
+		}
+	}
+	return class, limit, nil
+}
+
+// Middleware spends a token of the client's budget for the route class, rejecting the request with 429 and
+// a Retry-After header once it's spent. A nil limiter lets every request through
+func (rl *RateLimiter) Middleware(class string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rl == nil {
+			return
+		}
+		limit, ok := rl.limits[class]
+		if !ok {
+			return
+		}
+		ctx := c.Request.Context()
+		client := rl.client(c)
+		if client == "" {
+			return
+		}
+		key := class + "#" + client
+		allowed, retryAfter, err := rl.store.Take(ctx, key, limit)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to check the rate limit, letting the request through", "Error", err)
+			return
+		}
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			abortWithError(c, &TooManyRequestsError{RetryAfter: retryAfter})
+		}
+	}
+}
+
+// client identifies the caller, API keys are hashed so they aren't stored. Empty when the caller is unknown
+func (rl *RateLimiter) client(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" && slices.Contains(rl.apiKeys, key) {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	if address := rl.clientIP(c); address != "" {
+		return "ip:" + address
+	}
+	return ""
+}
+
+// clientIP reads the client address from the ipHeader set by the proxy in front of the API when the request proves
+// it went through the proxy with proxySecret. Otherwise it's the address CloudFront saw, empty when the request didn't
+// go through CloudFront. X-Forwarded-For isn't used, behind CloudFront its last entry is the edge, not the client
+func (rl *RateLimiter) clientIP(c *gin.Context) string {
+	if rl.proxySecret != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader(proxySecretHeader)), []byte(rl.proxySecret)) == 1 {
+		if address := c.GetHeader(rl.ipHeader); address != "" {
+			return address
+		}
+	}
+	// the port follows the last colon, IPv6 addresses aren't bracketed
+	if viewer := c.GetHeader(viewerAddressHeader); strings.Contains(viewer, ":") {
+		return viewer[:strings.LastIndex(viewer, ":")]
+	}
+	return ""
+}
+
+// tokenBucket is the state of a bucket, tokens as of updated
+type tokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// take refills the bucket up to now then spends a token if there is one
+func (b *tokenBucket) take(now time.Time, limit RateLimit) (bool, time.Duration) {
+	if b.Updated.IsZero() {
+		b.Tokens = limit.Burst
+	} else if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(limit.Burst, b.Tokens+elapsed*limit.Rate)
+	}
+	b.Updated = now
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.Tokens) / limit.Rate * float64(time.Second))
+}
+
+// full tells whether the bucket refilled completely by now, such buckets can be forgotten
+func (b *tokenBucket) full(now time.Time, limit RateLimit) bool {
+	return b.Tokens+now.Sub(b.Updated).Seconds()*limit.Rate >= limit.Burst
+}
+
+// maxMemoryBuckets is the number of buckets past which full buckets are swept
+const maxMemoryBuckets = 10000
+
+// MemoryRateLimitStore keeps the buckets of a single instance
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	now     func() time.Time
+}
+
+type memoryBucket struct {
+	tokenBucket
+	limit RateLimit
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*memoryBucket{}, now: time.Now}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	bucket, ok := s.buckets[key]
+	if !ok {
+		if len(s.buckets) >= maxMemoryBuckets {
+			s.sweep(now)
+		}
+		bucket = &memoryBucket{}
+		s.buckets[key] = bucket
+	}
+	bucket.limit = limit
+	allowed, retryAfter := bucket.take(now, limit)
+	return allowed, retryAfter, nil
+}
+
+// sweep forgets the buckets that refilled, they would start full anyway
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, bucket := range s.buckets {
+		if bucket.full(now, bucket.limit) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// maxBucketWriteAttempts bounds the retries of a bucket update racing other instances
+const maxBucketWriteAttempts = 3
+
+// DynamoRateLimitStore keeps the buckets in an on-demand table of their own so every instance shares them, each take
+// is a consistent read and a conditional write. Buckets expire through the table TTL once they would have refilled
+type DynamoRateLimitStore struct {
+	repository *BlogRepository
+	table      string
+	now        func() time.Time
+}
+
+func (s *DynamoRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	for attempt := 1; ; attempt++ {
+		bucket, err := s.repository.GetRateLimitBucket(ctx, s.table, key)
+		if err != nil {
+			return false, 0, err
+		}
+		previous := bucket.Updated
+		allowed, retryAfter := bucket.take(now(), limit)
+		if !allowed {
+			return false, retryAfter, nil
+		}
+		expires := bucket.Updated.Add(time.Duration((limit.Burst - bucket.Tokens) / limit.Rate * float64(time.Second)))
+		err = s.repository.PutRateLimitBucket(ctx, s.table, key, *bucket, previous, expires)
+		if err == nil {
+			return true, 0, nil
+		}
+		var conditionFailed *dynamoType.ConditionalCheckFailedException
+		if !errors.As(err, &conditionFailed) || attempt == maxBucketWriteAttempts {
+			return false, 0, err
+		}
+	}
+}
+
+// GetRateLimitBucket returns the bucket of key from the rate limit table, empty when it doesn't exist
+func (r *BlogRepository) GetRateLimitBucket(ctx context.Context, table, key string) (*tokenBucket, error) {
+	result, err := r.Db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(table),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]dynamoType.AttributeValue{
+			"PK": &dynamoType.AttributeValueMemberS{Value: key},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	bucket := &tokenBucket{}
+	tokens, tokensOk := result.Item["tokens"].(*dynamoType.AttributeValueMemberN)
+	updated, updatedOk := result.Item["updated_at"].(*dynamoType.AttributeValueMemberN)
+	if !tokensOk || !updatedOk {
+		return bucket, nil
+	}
+	if bucket.Tokens, err = strconv.ParseFloat(tokens.Value, 64); err != nil {
+		return nil, err
+	}
+	nanos, err := strconv.ParseInt(updated.Value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	bucket.Updated = time.Unix(0, nanos)
+	return bucket, nil
+}
+
+// PutRateLimitBucket writes the bucket of key unless another instance updated it since previous
+func (r *BlogRepository) PutRateLimitBucket(ctx context.Context, table, key string, bucket tokenBucket, previous, expires time.Time) error {
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item: map[string]dynamoType.AttributeValue{
+			"PK":         &dynamoType.AttributeValueMemberS{Value: key},
+			"tokens":     &dynamoType.AttributeValueMemberN{Value: strconv.FormatFloat(bucket.Tokens, 'f', -1, 64)},
+			"updated_at": &dynamoType.AttributeValueMemberN{Value: strconv.FormatInt(bucket.Updated.UnixNano(), 10)},
+			"expires_at": &dynamoType.AttributeValueMemberN{Value: strconv.FormatInt(expires.Unix()+1, 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	}
+	if !previous.IsZero() {
+		input.ConditionExpression = aws.String("updated_at = :previous")
+		input.ExpressionAttributeValues = map[string]dynamoType.AttributeValue{
+			":previous": &dynamoType.AttributeValueMemberN{Value: strconv.FormatInt(previous.UnixNano(), 10)},
+		}
+	}
+	_, err := r.Db.PutItem(ctx, input)
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	limiter := &RateLimiter{
+		store:    store,
+		limits:   map[string]RateLimit{writeRateLimit: {Rate: 0.5, Burst: 2}},
+		apiKeys:  []string{"automation"},
+		ipHeader: defaultClientIPHeader,
+	}
+	router := gin.New()
+	router.Use(ProblemMiddleware())
+	router.PUT("/blog/v1/posts", limiter.Middleware(writeRateLimit), func(c *gin.Context) {
+		c.JSON(200, MessageResponse{Message: "ok"})
+	})
+	send := func(viewer, apiKey string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("PUT", "/blog/v1/posts", nil)
+		request.Header.Set("CloudFront-Viewer-Address", viewer)
+		request.Header.Set("X-API-Key", apiKey)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for range 2 {
+		if recorder := send("203.0.113.7:443", ""); recorder.Code != 200 {
+			t.Fatalf("expected the burst to be allowed, got %d", recorder.Code)
+		}
+	}
+	recorder := send("203.0.113.7:443", "unknown")
+	if recorder.Code != 429 || recorder.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected 429 retrying in 2s, got %d with %q", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+	if recorder := send("2001:db8::1:443", ""); recorder.Code != 200 {
+		t.Errorf("other clients have their own budget, got %d", recorder.Code)
+	}
+	if recorder := send("203.0.113.7:443", "automation"); recorder.Code != 200 {
+		t.Errorf("known API keys have their own budget, got %d", recorder.Code)
+	}
+	// without a trusted address the client can't be told apart, it isn't limited
+	if recorder := send("", ""); recorder.Code != 200 {
+		t.Errorf("expected requests without a viewer address to be let through, got %d", recorder.Code)
+	}
+	now = now.Add(2 * time.Second)
+	if recorder := send("203.0.113.7:443", ""); recorder.Code != 200 {
+		t.Errorf("expected the bucket to refill, got %d", recorder.Code)
+	}
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := &RateLimiter{ipHeader: defaultClientIPHeader, proxySecret: "s3cret"}
+	cases := map[string]struct {
+		headers map[string]string
+		want    string
+	}{
+		"proven proxy": {map[string]string{"CF-Connecting-IP": "203.0.113.7", "X-Origin-Secret": "s3cret",
+			"CloudFront-Viewer-Address": "198.51.100.1:443"}, "203.0.113.7"},
+		"spoofed header": {map[string]string{"CF-Connecting-IP": "203.0.113.7",
+			"CloudFront-Viewer-Address": "198.51.100.1:443"}, "198.51.100.1"},
+		"wrong secret": {map[string]string{"CF-Connecting-IP": "203.0.113.7", "X-Origin-Secret": "guess",
+			"CloudFront-Viewer-Address": "198.51.100.1:443"}, "198.51.100.1"},
+		"ipv6 viewer":     {map[string]string{"CloudFront-Viewer-Address": "2001:db8::1:443"}, "2001:db8::1"},
+		"forwarded only":  {map[string]string{"X-Forwarded-For": "10.0.0.1, 198.51.100.2"}, ""},
+		"no address":      {map[string]string{}, ""},
+		"secret, no addr": {map[string]string{"X-Origin-Secret": "s3cret", "X-Forwarded-For": "198.51.100.3"}, ""},
+	}
+	for name, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/blog/v1/posts", nil)
+		for header, value := range tc.headers {
+			c.Request.Header.Set(header, value)
+		}
+		if got := limiter.clientIP(c); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", name, tc.want, got)
+		}
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	class, limit, err := parseRateLimit("sync=2/1h:3")
+	if err != nil || class != "sync" || limit.Burst != 3 || limit.Rate != 2.0/3600 {
+		t.Errorf("unexpected limit %s %+v %v", class, limit, err)
+	}
+	if _, limit, _ := parseRateLimit("read=600/1m"); limit.Burst != 600 || limit.Rate != 10 {
+		t.Errorf("expected the count to be the burst by default, got %+v", limit)
+	}
+	for _, entry := range []string{"read", "read=0/1m", "read=10/soon", "read=10/1m:0"} {
+		if _, _, err := parseRateLimit(entry); err == nil {
+			t.Errorf("expected %q to be rejected", entry)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultReadCacheSize = 512
+	// defaultReadCacheTTL bounds how long an instance serves a read after another instance wrote it,
+	// writes only invalidate the cache of the instance handling them
+	defaultReadCacheTTL = 30 * time.Second
+)
+
+// ReadCache is an in-process LRU cache in front of the hottest repository reads. Identical reads in flight
+// are coalesced into a single query and entries are dropped by the surrogate keys of the data they hold.
+// A nil cache reads through
+type ReadCache struct {
+	mu         sync.Mutex
+	size       int
+	ttl        time.Duration
+	entries    map[string]*list.Element
+	order      *list.List // most recently used first
+	generation uint64     // bumped by every invalidation, loads started before one aren't stored
+	loads      singleflight.Group
+	reads      metric.Int64Counter
+	now        func() time.Time
+}
+
+type readCacheEntry struct {
+	key     string
+	value   any
+	keys    []string // surrogate keys of the value
+	expires time.Time
+}
+
+func NewReadCache(size int, ttl time.Duration) *ReadCache {
+	reads, err := otel.Meter("cloudificando").Int64Counter(
+		"blog.read_cache.reads",
+		metric.WithDescription("Repository reads served through the in-process cache"),
+		metric.WithUnit("{read}"),
+	)
+	if err != nil {
+		slog.Error("Failed to create the read cache counter", "Error", err)
+	}
+	return &ReadCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+		reads:   reads,
+		now:     time.Now,
+	}
+}
+
+// NewReadCacheFromEnv reads READ_CACHE_SIZE, the number of entries, and READ_CACHE_TTL, a duration e.g. "1m".
+// A size of 0 disables the cache
+func NewReadCacheFromEnv() *ReadCache {
+	size := envInt("READ_CACHE_SIZE", defaultReadCacheSize, 0)
+	if size == 0 {
+		return nil
+	}
+	return NewReadCache(size, envDuration("READ_CACHE_TTL", defaultReadCacheTTL))
+}
+
+// cachedRead returns the cached value of key or loads it, sharing the load with concurrent reads of the same key.
+// The surrogate keys the load adds are kept with the value and added to the context of every read it serves.
+// Errors aren't cached. Loads run detached from the cancellation of the read that started them, as other reads may wait on them
+func cachedRead[T any](ctx context.Context, cache *ReadCache, key string, load func(context.Context) (T, error)) (T, error) {
+	if cache == nil {
+		return load(ctx)
+	}
+	if entry, ok := cache.get(key); ok {
+		cache.count(ctx, "hit")
+		addSurrogateKeys(ctx, entry.keys...)
+		return entry.value.(T), nil
+	}
+	result, err, shared := cache.loads.Do(key, func() (any, error) {
+		generation := cache.currentGeneration()
+		collector := &surrogateKeys{}
+		loadCtx := context.WithValue(context.WithoutCancel(ctx), surrogateKeysContextKey{}, collector)
+		value, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+		entry := readCacheEntry{key: key, value: value, keys: collector.list()}
+		cache.put(entry, generation)
+		return entry, nil
+	})
+	if shared {
+		cache.count(ctx, "shared")
+	} else {
+		cache.count(ctx, "miss")
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	entry := result.(readCacheEntry)
+	addSurrogateKeys(ctx, entry.keys...)
+	return entry.value.(T), nil
+}
+
+func (rc *ReadCache) get(key string) (readCacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	element, ok := rc.entries[key]
+	if !ok {
+		return readCacheEntry{}, false
+	}
+	entry := element.Value.(*readCacheEntry)
+	if !rc.now().Before(entry.expires) {
+		rc.remove(element)
+		return readCacheEntry{}, false
+	}
+	rc.order.MoveToFront(element)
+	return *entry, true
+}
+
+func (rc *ReadCache) put(entry readCacheEntry, generation uint64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if generation != rc.generation {
+		return
+	}
+	entry.expires = rc.now().Add(rc.ttl)
+	if element, ok := rc.entries[entry.key]; ok {
+		element.Value = &entry
+		rc.order.MoveToFront(element)
+		return
+	}
+	rc.entries[entry.key] = rc.order.PushFront(&entry)
+	for rc.order.Len() > rc.size {
+		rc.remove(rc.order.Back())
+	}
+}
+
+func (rc *ReadCache) remove(element *list.Element) {
+	rc.order.Remove(element)
+	delete(rc.entries, element.Value.(*readCacheEntry).key)
+}
+
+func (rc *ReadCache) currentGeneration() uint64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.generation
+}
+
+// Invalidate drops the entries holding data tagged with any of the surrogate keys,
+// and keeps loads in flight from storing what they read before the write
+func (rc *ReadCache) Invalidate(keys ...string) {
+	if rc == nil {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.generation++
+	for element := rc.order.Front(); element != nil; {
+		next := element.Next()
+		for _, key := range element.Value.(*readCacheEntry).keys {
+			if slices.Contains(keys, key) {
+				rc.remove(element)
+				break
+			}
+		}
+		element = next
+	}
+}
+
+func (rc *ReadCache) count(ctx context.Context, result string) {
+	if rc.reads != nil {
+		rc.reads.Add(ctx, 1, metric.WithAttributes(attribute.String("result", result)))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadCacheCoalescesAndInvalidates(t *testing.T) {
+	cache := NewReadCache(2, time.Minute)
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (*Post, error) {
+		loads.Add(1)
+		<-release
+		addSurrogateKeys(ctx, postKey("a"))
+		return &Post{Slug: "a"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cachedRead(context.Background(), cache, "post:a", load); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := loads.Load(); got != 1 {
+		t.Errorf("expected concurrent reads to share one load, got %d", got)
+	}
+
+	collector := &surrogateKeys{}
+	ctx := context.WithValue(context.Background(), surrogateKeysContextKey{}, collector)
+	if _, err := cachedRead(ctx, cache, "post:a", load); err != nil {
+		t.Fatal(err)
+	}
+	if loads.Load() != 1 || len(collector.list()) != 1 {
+		t.Errorf("expected a hit tagged with the keys of the load, got %d loads and keys %v", loads.Load(), collector.list())
+	}
+
+	cache.Invalidate(listPostsKey)
+	if _, ok := cache.get("post:a"); !ok {
+		t.Error("entries without the invalidated keys should be kept")
+	}
+	cache.Invalidate(postKey("a"))
+	if _, ok := cache.get("post:a"); ok {
+		t.Error("entries with the invalidated keys should be dropped")
+	}
+}
+
+func TestReadCacheEviction(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewReadCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+	for _, key := range []string{"a", "b"} {
+		cache.put(readCacheEntry{key: key, value: key}, 0)
+	}
+	cache.get("a")
+	cache.put(readCacheEntry{key: "c", value: "c"}, 0)
+	if _, ok := cache.get("b"); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	generation := cache.currentGeneration()
+	cache.Invalidate(postKey("a"))
+	cache.put(readCacheEntry{key: "d", value: "d"}, generation)
+	if _, ok := cache.get("d"); ok {
+		t.Error("loads started before an invalidation shouldn't be stored")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := cache.get("a"); ok {
+		t.Error("expected expired entries to be dropped")
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoType "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// relatedLimit is how many related posts are precomputed per post
+	relatedLimit = 4
+	// relatedRecencyWeight scales the recency bonus against the tag overlap score
+	relatedRecencyWeight = 0.5
+	// relatedRecencyHalfLife is the age at which a post gets half of the recency bonus
+	relatedRecencyHalfLife = 365 * 24 * time.Hour
+	// relatedRefreshLimit is how many posts sharing a tag with a written post have their related posts refreshed
+	relatedRefreshLimit = 2 * relatedLimit
+)
+
+// GetRelated returns the precomputed related posts of a post, best match first
+func (r *BlogRepository) GetRelated(ctx context.Context, slug string) ([]Post, error) {
+	result, err := r.Db.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		IndexName:              aws.String("LSI2"),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]dynamoType.AttributeValue{
+			":pk": &dynamoType.AttributeValueMemberS{Value: relatedPartitionKey(slug)},
+		},
+		ScanIndexForward: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// a post without related posts has an empty partition too, only then tell it apart from a missing post
+	if len(result.Items) == 0 {
+		post, err := r.getPostItem(ctx, slug)
+		if err != nil {
+			return nil, err
+		}
+		if post == nil {
+			return nil, &NotFoundError{Resource: "post", Key: slug}
+		}
+	}
+	posts := make([]Post, 0, len(result.Items))
+	for _, item := range result.Items {
+		var post Post
+		if err := attributevalue.UnmarshalMap(item, &post); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	// related posts are refreshed by writes to any post sharing a tag, so they're tagged as a listing
+	addSurrogateKeys(ctx, postKey(slug), listPostsKey)
+	addSurrogateKeys(ctx, postKeys(posts)...)
+	return posts, nil
+}
+
+// RefreshRelatedAround recomputes the related posts of a post and of its closest matches among the posts sharing a tag,
+// tags holds both the current and the previous tags so posts that lost the overlap are considered too.
+// Only relatedRefreshLimit matches are refreshed to bound the work of a single write, syncs refresh every post
+func (r *BlogRepository) RefreshRelatedAround(ctx context.Context, slug string, tags []string) error {
+	scorer := newRelatedScorer(r)
+	tags = slices.Clone(tags)
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+	matches, err := scorer.rank(ctx, Post{Slug: slug, Tags: tags}, relatedRefreshLimit)
+	if err != nil {
+		return err
+	}
+	affected := append([]string{slug}, postSlugs(matches)...)
+	return r.refreshRelated(ctx, scorer, affected)
+}
+
+// RefreshAllRelated recomputes the related posts of every post
+func (r *BlogRepository) RefreshAllRelated(ctx context.Context) error {
+	scorer := newRelatedScorer(r)
+	posts, err := scorer.tagPosts(ctx, "")
+	if err != nil {
+		return err
+	}
+	slugs := make([]string, 0, len(posts))
+	for _, post := range posts {
+		slugs = append(slugs, post.Slug)
+	}
+	return r.refreshRelated(ctx, scorer, slugs)
+}
+
+func (r *BlogRepository) refreshRelated(ctx context.Context, scorer *relatedScorer, slugs []string) error {
+	for _, slug := range slugs {
+		post, err := r.getPostItem(ctx, slug)
+		if err != nil {
+			return err
+		}
+		var related []Post
+		if post != nil {
+			related, err = scorer.score(ctx, *post)
+			if err != nil {
+				return err
+			}
+		}
+		if err := r.replaceRelatedItems(ctx, slug, related); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceRelatedItems overwrites the RELATED# partition of a post, SK_LSI2 holds the rank
+func (r *BlogRepository) replaceRelatedItems(ctx context.Context, slug string, related []Post) error {
+	tableName := r.tableName
+	pk := relatedPartitionKey(slug)
+	current, err := r.Db.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]dynamoType.AttributeValue{
+			":pk": &dynamoType.AttributeValueMemberS{Value: pk},
+		},
+		ProjectionExpression: aws.String("PK, SK"),
+	})
+	if err != nil {
+		return err
+	}
+
+	var writeRequests []dynamoType.WriteRequest
+	for rank, post := range related {
+		item := postItem(post, pk, "RELATED_POST")
+		item["SK_LSI2"] = &dynamoType.AttributeValueMemberS{Value: rankSortKey(rank)}
+		writeRequests = append(writeRequests, dynamoType.WriteRequest{
+			PutRequest: &dynamoType.PutRequest{Item: item},
+		})
+	}
+	for _, key := range current.Items {
+		sk := key["SK"].(*dynamoType.AttributeValueMemberS).Value
+		stillRelated := slices.ContainsFunc(related, func(post Post) bool {
+			return fmt.Sprintf("POST#%s", post.Slug) == sk
+		})
+		if stillRelated {
+			continue
+		}
+		writeRequests = append(writeRequests, dynamoType.WriteRequest{
+			DeleteRequest: &dynamoType.DeleteRequest{Key: key},
+		})
+	}
+
+	return r.batchWrite(ctx, writeRequests)
+}
+
+// relatedScorer ranks posts by weighted tag overlap and recency,
+// partitions and counts are memoized so refreshing many posts reads each partition once
+type relatedScorer struct {
+	repository *BlogRepository
+	partitions map[string][]Post
+	counts     map[string]int
+	now        time.Time
+}
+
+func newRelatedScorer(repository *BlogRepository) *relatedScorer {
+	return &relatedScorer{
+		repository: repository,
+		partitions: map[string][]Post{},
+		counts:     map[string]int{},
+		now:        time.Now(),
+	}
+}
+
+func (s *relatedScorer) score(ctx context.Context, post Post) ([]Post, error) {
+	return s.rank(ctx, post, relatedLimit)
+}
+
+// rank returns up to limit posts sharing a tag with post, best match first
+func (s *relatedScorer) rank(ctx context.Context, post Post, limit int) ([]Post, error) {
+	total, err := s.count(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	scores := map[string]float64{}
+	candidates := map[string]Post{}
+	for _, tag := range post.Tags {
+		tagCount, err := s.count(ctx, tag)
+		if err != nil {
+			return nil, err
+		}
+		// rarer tags say more about a post, weigh them by inverse document frequency
+		weight := math.Log(1 + float64(total)/float64(max(tagCount, 1)))
+		posts, err := s.tagPosts(ctx, tag)
+		if err != nil {
+			return nil, err
+		}
+		for _, candidate := range posts {
+			if candidate.Slug == post.Slug {
+				continue
+			}
+			scores[candidate.Slug] += weight
+			candidates[candidate.Slug] = candidate
+		}
+	}
+
+	related := make([]Post, 0, len(candidates))
+	for slug, candidate := range candidates {
+		scores[slug] += relatedRecencyWeight * s.recency(candidate)
+		related = append(related, candidate)
+	}
+	sort.Slice(related, func(i, j int) bool {
+		if scores[related[i].Slug] != scores[related[j].Slug] {
+			return scores[related[i].Slug] > scores[related[j].Slug]
+		}
+		return related[i].Slug < related[j].Slug
+	})
+	if len(related) > limit {
+		related = related[:limit]
+	}
+	return related, nil
+}
+
+// recency decays from 1 for a post created now to 0.5 after relatedRecencyHalfLife
+func (s *relatedScorer) recency(post Post) float64 {
+	createdAt, ok := parsePostDate(post.CreatedAt)
+	if !ok {
+		return 0
+	}
+	age := max(s.now.Sub(createdAt), 0)
+	return math.Pow(0.5, float64(age)/float64(relatedRecencyHalfLife))
+}
+
+// tagPosts returns every post of a tag partition, or of the POST partition when tag is empty
+func (s *relatedScorer) tagPosts(ctx context.Context, tag string) ([]Post, error) {
+	if posts, ok := s.partitions[tag]; ok {
+		return posts, nil
+	}
+	// refreshes run right after a write, read it back consistently
+	posts, err := s.repository.partitionPosts(ctx, tag, true)
+	if err != nil {
+		return nil, err
+	}
+	s.partitions[tag] = posts
+	return posts, nil
+}
+
+// partitionPosts returns every post of a tag partition, or of the POST partition when tag is empty, oldest first
+func (r *BlogRepository) partitionPosts(ctx context.Context, tag string, consistent bool) ([]Post, error) {
+	paginator := dynamodb.NewQueryPaginator(r.Db, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		IndexName:              aws.String("LSI1"),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]dynamoType.AttributeValue{
+			":pk": &dynamoType.AttributeValueMemberS{Value: postsPartitionKey(tag)},
+		},
+		ConsistentRead: aws.Bool(consistent),
+	})
+	var posts []Post
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			var post Post
+			if err := attributevalue.UnmarshalMap(item, &post); err != nil {
+				return nil, err
+			}
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+// count reads the maintained counter of a partition, falling back to its size when counters aren't seeded
+func (s *relatedScorer) count(ctx context.Context, tag string) (int, error) {
+	if count, ok := s.counts[tag]; ok {
+		return count, nil
+	}
+	count, err := s.repository.CountPosts(ctx, tag)
+	if err != nil {
+		return 0, err
+	}
+	if count <= 0 {
+		posts, err := s.tagPosts(ctx, tag)
+		if err != nil {
+			return 0, err
+		}
+		count = len(posts)
+	}
+	s.counts[tag] = count
+	return count, nil
+}
+
+func relatedPartitionKey(slug string) string {
+	return fmt.Sprintf("RELATED#%s", slug)
+}
+
+// parsePostDate parses created_at, which the frontmatter carries either as a date or a timestamp
+func parsePostDate(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestRelatedPostsRanking(t *testing.T) {
+	ctx := context.Background()
+	_, repository := newFakeDynamo(t)
+	for _, post := range []Post{
+		testPost("both", "2024-01-01", "go", "aws"),
+		testPost("rare", "2024-01-01", "rare"),
+		testPost("new-go", "2024-05-01", "go"),
+		testPost("old-go", "2020-01-01", "go"),
+		testPost("older-go", "2019-01-01", "go"),
+		testPost("other", "2024-01-01", "k8s"),
+		testPost("post", "2024-06-01", "go", "aws", "rare"),
+	} {
+		if _, err := repository.UpsertPost(ctx, post); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	related := func(slug string) []string {
+		t.Helper()
+		posts, err := repository.GetRelated(ctx, slug)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return postSlugs(posts)
+	}
+
+	// more shared tags rank first, a rare tag outweighs a common one, recency breaks the remaining ties
+	// and posts without a shared tag or past relatedLimit are left out
+	if got := related("post"); !slices.Equal(got, []string{"both", "rare", "new-go", "old-go"}) {
+		t.Errorf("unexpected related posts %v", got)
+	}
+	if got := related("other"); len(got) != 0 {
+		t.Errorf("expected no related posts, got %v", got)
+	}
+
+	if _, err := repository.DeletePost(ctx, "both"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := related("post"); !slices.Equal(got, []string{"rare", "new-go", "old-go", "older-go"}) {
+		t.Errorf("expected the deleted post to be replaced, got %v", got)
+	}
+	if _, err := repository.GetRelated(ctx, "both"); err == nil {
+		t.Errorf("expected the related posts of a deleted post to be not found")
+	} else if _, ok := err.(*NotFoundError); !ok {
+		t.Errorf("expected a NotFoundError, got %v", err)
+	}
+}
@@ -2,8 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -12,10 +11,15 @@ import (
 	cloudfrontType "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamoType "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"log/slog"
+	mathrand "math/rand/v2"
 	"os"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -25,9 +29,14 @@ type BlogRepository struct {
 	tableName          string
 	cloudfrontDistroId string
 	cdn                *cloudfront.Client
+	queue              *sqs.Client
+	cursors            *CursorCodec
+	cache              *ReadCache
 }
 
-func NewBlogRepository(ctx context.Context, db *dynamodb.Client, tn string, cdn *cloudfront.Client, ps *ssm.Client) (
+func NewBlogRepository(
+	ctx context.Context, db *dynamodb.Client, tn string, cdn *cloudfront.Client, queue *sqs.Client, ps *ssm.Client,
+) (
 	*BlogRepository, error,
 ) {
 	ssmDistroIdPath := os.Getenv("AWS_SSM_CLOUDFRONT_DISTRO_ID_PATH")
@@ -42,26 +51,30 @@ func NewBlogRepository(ctx context.Context, db *dynamodb.Client, tn string, cdn
 		}
 		cloudfrontDistroId = *cloudfrontDistroIdParam.Parameter.Value
 	}
+	cursorSecret, err := loadCursorSecret()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load cursor secret", "Error", err)
+		return nil, err
+	}
 	return &BlogRepository{
 		Db:                 db,
 		tableName:          tn,
 		cloudfrontDistroId: cloudfrontDistroId,
 		cdn:                cdn,
+		queue:              queue,
+		cursors:            NewCursorCodec(cursorSecret),
+		cache:              NewReadCacheFromEnv(),
 	}, nil
 }
-func (r *BlogRepository) UpsertPost(ctx context.Context, post Post) error {
+
+// UpsertPost writes a post and refreshes the related posts around it, it returns the post as it was before, if any
+func (r *BlogRepository) UpsertPost(ctx context.Context, post Post) (*Post, error) {
 	db := r.Db
 	tableName := r.tableName
 	// Insert Tag Metadata Conditionally
 	for _, tag := range post.Tags {
 		// Prepare TagMetadata item
-		tagMetadataItem := map[string]dynamoType.AttributeValue{
-			"PK":   &dynamoType.AttributeValueMemberS{Value: "TAG"},
-			"SK":   &dynamoType.AttributeValueMemberS{Value: "TAG#" + tag},
-			"slug": &dynamoType.AttributeValueMemberS{Value: tag},
-			"Type": &dynamoType.AttributeValueMemberS{Value: "TAG"},
-			// Add other metadata fields as needed
-		}
+		tagMetadataItem := tagMetadataItem(tag)
 
 		// Prepare PutItemInput with ConditionExpression
 		putItemInput := &dynamodb.PutItemInput{
@@ -86,66 +99,18 @@ func (r *BlogRepository) UpsertPost(ctx context.Context, post Post) error {
 		}
 		slog.Info("Inserted tag metadata", "Tag", tag)
 	}
-
-	// Begin Transaction for Upserting Post and Tag-Post Mappings
-	var transactItems []dynamoType.TransactWriteItem
-
-	// Upsert Post by Creation Date
-	postByDateItem := map[string]dynamoType.AttributeValue{
-		"PK":          &dynamoType.AttributeValueMemberS{Value: "POST"},
-		"SK":          &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("POST#%s", post.Slug)},
-		"SK_LSI1":     &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("CREATED_AT#%s#POST#%s", post.CreatedAt, post.Slug)},
-		"title":       &dynamoType.AttributeValueMemberS{Value: post.Title},
-		"tags":        &dynamoType.AttributeValueMemberL{Value: stringSliceToDynamoDB(post.Tags)},
-		"created_at":  &dynamoType.AttributeValueMemberS{Value: post.CreatedAt},
-		"description": &dynamoType.AttributeValueMemberS{Value: post.Description},
-		"slug":        &dynamoType.AttributeValueMemberS{Value: post.Slug},
-		"Type":        &dynamoType.AttributeValueMemberS{Value: "POST"},
-	}
-	transactItems = append(transactItems, dynamoType.TransactWriteItem{
-		Put: &dynamoType.Put{
-			TableName: &tableName,
-			Item:      postByDateItem,
-		},
-	})
-
-	// Upsert Tag-Post Mapping
-	for _, tag := range post.Tags {
-		// Tag-Post Item
-		tagPostItem := map[string]dynamoType.AttributeValue{
-			"PK":          &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("TAG#%s", tag)},
-			"SK":          &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("POST#%s", post.Slug)},
-			"SK_LSI1":     &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("CREATED_AT#%s#POST#%s", post.CreatedAt, post.Slug)},
-			"title":       &dynamoType.AttributeValueMemberS{Value: post.Title},
-			"tags":        &dynamoType.AttributeValueMemberL{Value: stringSliceToDynamoDB(post.Tags)},
-			"created_at":  &dynamoType.AttributeValueMemberS{Value: post.CreatedAt},
-			"description": &dynamoType.AttributeValueMemberS{Value: post.Description},
-			"slug":        &dynamoType.AttributeValueMemberS{Value: post.Slug},
-			"Type":        &dynamoType.AttributeValueMemberS{Value: "TAG_POST"},
-		}
-
-		transactItems = append(transactItems, dynamoType.TransactWriteItem{
-			Put: &dynamoType.Put{
-				TableName: &tableName,
-				Item:      tagPostItem,
-			},
-		})
-	}
-
-	// Execute Transaction
-	_, err := db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-		TransactItems: transactItems,
-	})
+	existing, err := r.upsertPostItems(ctx, post)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	affectedTags := slices.Clone(post.Tags)
+	if existing != nil {
+		affectedTags = append(affectedTags, existing.Tags...)
+	}
+	return existing, r.RefreshRelatedAround(ctx, post.Slug, affectedTags)
 }
 
 func (r *BlogRepository) UpsertPostsBatch(ctx context.Context, posts []Post) error {
-	db := r.Db
-	tableName := r.tableName
-
 	var tagsSet = make(map[string]string) //  deduplicate tags
 	for _, post := range posts {
 		for _, tag := range post.Tags {
@@ -157,113 +122,222 @@ func (r *BlogRepository) UpsertPostsBatch(ctx context.Context, posts []Post) err
 	for tag := range tagsSet {
 		tagBatchItems = append(tagBatchItems, dynamoType.WriteRequest{
 			PutRequest: &dynamoType.PutRequest{
-				Item: map[string]dynamoType.AttributeValue{
-					"PK":   &dynamoType.AttributeValueMemberS{Value: "TAG"},
-					"SK":   &dynamoType.AttributeValueMemberS{Value: "TAG#" + tag},
-					"slug": &dynamoType.AttributeValueMemberS{Value: tag},
-					"Type": &dynamoType.AttributeValueMemberS{Value: "TAG"},
-				},
+				Item: tagMetadataItem(tag),
 			},
 		})
 	}
-	_, err := db.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
-		RequestItems: map[string][]dynamoType.WriteRequest{
-			tableName: tagBatchItems,
-		},
-	})
-	if err != nil {
+	if err := r.batchWrite(ctx, tagBatchItems); err != nil {
 		return err
 	}
-	// Upsert Posts and Tag-Post Mappings
-	var transactItems []dynamoType.TransactWriteItem
+	// Upsert Posts and Tag-Post Mappings, one transaction per post
 	for _, post := range posts {
-		// Upsert Post by Creation Date
-		postByDateItem := map[string]dynamoType.AttributeValue{
-			"PK":          &dynamoType.AttributeValueMemberS{Value: "POST"},
-			"SK":          &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("POST#%s", post.Slug)},
-			"SK_LSI1":     &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("CREATED_AT#%s#POST#%s", post.CreatedAt, post.Slug)},
-			"title":       &dynamoType.AttributeValueMemberS{Value: post.Title},
-			"tags":        &dynamoType.AttributeValueMemberL{Value: stringSliceToDynamoDB(post.Tags)},
-			"created_at":  &dynamoType.AttributeValueMemberS{Value: post.CreatedAt},
-			"description": &dynamoType.AttributeValueMemberS{Value: post.Description},
-			"slug":        &dynamoType.AttributeValueMemberS{Value: post.Slug},
-			"Type":        &dynamoType.AttributeValueMemberS{Value: "POST"},
+		if _, err := r.upsertPostItems(ctx, post); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upsertPostItems writes the post, its Tag-Post mappings and the counters in a single transaction,
+// mappings of tags the post no longer has are removed. It returns the post as it was before, if any
+func (r *BlogRepository) upsertPostItems(ctx context.Context, post Post) (*Post, error) {
+	db := r.Db
+	tableName := r.tableName
+
+	existing, err := r.getPostItem(ctx, post.Slug)
+	if err != nil {
+		return nil, err
+	}
+	// Metadata only updates keep the stats derived from the stored body
+	if post.Body != "" {
+		post.ApplyBodyStats()
+	} else if existing != nil {
+		post.WordCount, post.ReadingTime, post.Toc = existing.WordCount, existing.ReadingTime, existing.Toc
+	}
+
+	// Begin Transaction for Upserting Post and Tag-Post Mappings
+	var transactItems []dynamoType.TransactWriteItem
+
+	// Store the body chunks first, the POST item carries the manifest pointing to them
+	bodyHash, bodyChunks := "", 0
+	if post.Body != "" {
+		bodyHash, bodyChunks, err = r.putBodyChunks(ctx, post.Slug, post.Body)
+		if err != nil {
+			return nil, err
+		}
+	} else if existing != nil {
+		bodyHash, bodyChunks = existing.BodyHash, existing.BodyChunks
+	}
+	// updated_at only moves when the post changes, so hard syncs don't touch every sitemap lastmod
+	post.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if existing != nil && !postChanged(*existing, post, bodyHash) {
+		post.UpdatedAt = existing.UpdatedAt
+	}
+	postRecord := postItem(post, "POST", "POST")
+	if len(post.Toc) > 0 {
+		toc, err := attributevalue.Marshal(post.Toc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal the table of contents of %q: %w", post.Slug, err)
 		}
+		postRecord["toc"] = toc
+	}
+	if bodyHash != "" {
+		postRecord["body_sha256"] = &dynamoType.AttributeValueMemberS{Value: bodyHash}
+		postRecord["body_chunks"] = &dynamoType.AttributeValueMemberN{Value: strconv.Itoa(bodyChunks)}
+	}
+
+	// Upsert Post by Creation Date, guarded so concurrent writers can't skew the counters
+	postPut := &dynamoType.Put{
+		TableName:           &tableName,
+		Item:                postRecord,
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	}
+	if existing != nil {
+		postPut.ConditionExpression = aws.String("attribute_exists(PK)")
+	} else {
+		transactItems = append(transactItems, counterUpdate(tableName, postsPartitionKey(""), 1))
+	}
+	transactItems = append(transactItems, dynamoType.TransactWriteItem{Put: postPut})
+
+	// Upsert Tag-Post Mapping
+	for _, tag := range post.Tags {
 		transactItems = append(transactItems, dynamoType.TransactWriteItem{
 			Put: &dynamoType.Put{
 				TableName: &tableName,
-				Item:      postByDateItem,
+				Item:      postItem(post, postsPartitionKey(tag), "TAG_POST"),
 			},
 		})
+		if existing == nil || !slices.Contains(existing.Tags, tag) {
+			transactItems = append(transactItems, counterUpdate(tableName, postsPartitionKey(tag), 1))
+		}
+	}
 
-		// Upsert Tag-Post Mapping
-		for _, tag := range post.Tags {
-			// Tag-Post Item
-			tagPostItem := map[string]dynamoType.AttributeValue{
-				"PK":          &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("TAG#%s", tag)},
-				"SK":          &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("POST#%s", post.Slug)},
-				"SK_LSI1":     &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("CREATED_AT#%s#POST#%s", post.CreatedAt, post.Slug)},
-				"title":       &dynamoType.AttributeValueMemberS{Value: post.Title},
-				"tags":        &dynamoType.AttributeValueMemberL{Value: stringSliceToDynamoDB(post.Tags)},
-				"created_at":  &dynamoType.AttributeValueMemberS{Value: post.CreatedAt},
-				"description": &dynamoType.AttributeValueMemberS{Value: post.Description},
-				"slug":        &dynamoType.AttributeValueMemberS{Value: post.Slug},
-				"Type":        &dynamoType.AttributeValueMemberS{Value: "TAG_POST"},
-			}
+	// Upsert Series-Post Mapping, ordered by LSI2
+	if post.Series != "" {
+		transactItems = append(transactItems, dynamoType.TransactWriteItem{
+			Put: &dynamoType.Put{
+				TableName: &tableName,
+				Item:      seriesItem(post),
+			},
+		})
+	}
+	if existing != nil && existing.Series != "" && existing.Series != post.Series {
+		transactItems = append(transactItems, deleteSeriesItem(tableName, *existing))
+	}
 
+	// Remove mappings of tags dropped from the post
+	if existing != nil {
+		for _, tag := range existing.Tags {
+			if slices.Contains(post.Tags, tag) {
+				continue
+			}
 			transactItems = append(transactItems, dynamoType.TransactWriteItem{
-				Put: &dynamoType.Put{
+				Delete: &dynamoType.Delete{
 					TableName: &tableName,
-					Item:      tagPostItem,
+					Key: map[string]dynamoType.AttributeValue{
+						"PK": &dynamoType.AttributeValueMemberS{Value: postsPartitionKey(tag)},
+						"SK": &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("POST#%s", post.Slug)},
+					},
 				},
 			})
+			transactItems = append(transactItems, counterUpdate(tableName, postsPartitionKey(tag), -1))
 		}
+	}
 
-		// Execute Transaction
-		_, err := db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-			TransactItems: transactItems,
-		})
-		if err != nil {
-			return err
+	// Execute Transaction
+	_, err = db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if isConditionFailure(err) {
+		return nil, &ConflictError{Message: fmt.Sprintf("post %q was modified concurrently", post.Slug), Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.invalidateReads(post.Slug)
+	if post.Body != "" {
+		if err := r.pruneBodyChunks(ctx, post.Slug, bodyHash); err != nil {
+			return nil, err
 		}
 	}
-	return nil
+	return existing, nil
 }
-func (r *BlogRepository) GetPosts(ctx context.Context, limit int, tag, cursor string) (*ListPosts, error) {
+
+// GetPosts returns a page of posts, served from the read cache when possible
+func (r *BlogRepository) GetPosts(ctx context.Context, query ListPostsQuery) (*ListPosts, error) {
+	key := fmt.Sprintf("posts:%d:%q:%q:%q:%q:%q", query.Limit, query.Tag, query.Sort, query.From, query.To, query.Cursor)
+	page, err := cachedRead(ctx, r.cache, key, func(ctx context.Context) (*ListPosts, error) {
+		return r.queryPosts(ctx, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// callers set the total on their copy
+	result := *page
+	return &result, nil
+}
+
+func (r *BlogRepository) queryPosts(ctx context.Context, query ListPostsQuery) (*ListPosts, error) {
 	tableName := r.tableName
 	db := r.Db
+	cursorQuery := query.CursorQuery()
+	cursor := query.Cursor
 
-	var pk string
-	if tag != "" {
-		pk = fmt.Sprintf("TAG#%s", tag)
-	} else {
-		pk = "POST"
-	}
 	input := &dynamodb.QueryInput{
 		TableName:              &tableName,
 		KeyConditionExpression: aws.String("PK = :pk"),
 		ExpressionAttributeValues: map[string]dynamoType.AttributeValue{
-			":pk": &dynamoType.AttributeValueMemberS{Value: pk},
+			":pk": &dynamoType.AttributeValueMemberS{Value: postsPartitionKey(query.Tag)},
 		},
-		Limit:            aws.Int32(int32(limit)),
-		IndexName:        aws.String("LSI1"),
-		ScanIndexForward: aws.Bool(false),
+		Limit:     aws.Int32(int32(query.Limit)),
+		IndexName: aws.String("LSI1"),
 	}
+	projectPostListing(input)
+	lower, upper, err := createdAtRange(query.From, query.To)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case lower != "" && upper != "":
+		input.KeyConditionExpression = aws.String("PK = :pk AND SK_LSI1 BETWEEN :from AND :to")
+	case lower != "":
+		input.KeyConditionExpression = aws.String("PK = :pk AND SK_LSI1 >= :from")
+	case upper != "":
+		input.KeyConditionExpression = aws.String("PK = :pk AND SK_LSI1 < :to")
+	}
+	if lower != "" {
+		input.ExpressionAttributeValues[":from"] = &dynamoType.AttributeValueMemberS{Value: lower}
+	}
+	if upper != "" {
+		input.ExpressionAttributeValues[":to"] = &dynamoType.AttributeValueMemberS{Value: upper}
+	}
+	direction := CursorNext
 	if cursor != "" {
-		startKey, err := decodeCursor(cursor)
+		startKey, cursorDirection, err := r.cursors.Decode(cursorQuery, cursor)
 		if err != nil {
 			return nil, err
 		}
 		input.ExclusiveStartKey = startKey
+		direction = cursorDirection
+	}
+	// A previous page is read by walking the index backwards from the first item of the current page
+	scanForward := query.Sort == SortAsc
+	if direction == CursorPrev {
+		scanForward = !scanForward
 	}
+	input.ScanIndexForward = aws.Bool(scanForward)
 	result, err := db.Query(ctx, input)
 
 	if err != nil {
 		return nil, err
 	}
 
+	items := result.Items
+	if direction == CursorPrev {
+		slices.Reverse(items)
+	}
 	var posts []Post
-	for _, item := range result.Items {
+	for _, item := range items {
 		var post Post
 		err = attributevalue.UnmarshalMap(item, &post)
 		if err != nil {
@@ -271,19 +345,253 @@ func (r *BlogRepository) GetPosts(ctx context.Context, limit int, tag, cursor st
 		}
 		posts = append(posts, post)
 	}
+	addSurrogateKeys(ctx, listPostsKey)
+	if query.Tag != "" {
+		addSurrogateKeys(ctx, tagKey(query.Tag))
+	}
+	addSurrogateKeys(ctx, postKeys(posts)...)
 	listPostsResult := &ListPosts{
 		Items: posts,
 	}
-	if result.LastEvaluatedKey != nil && len(result.LastEvaluatedKey) > 0 {
-		nextCursor, err := encodeCursor(result.LastEvaluatedKey)
+	if len(items) == 0 {
+		return listPostsResult, nil
+	}
+	hasMore := len(result.LastEvaluatedKey) > 0
+	hasNext := hasMore
+	hasPrev := cursor != ""
+	if direction == CursorPrev {
+		hasNext, hasPrev = true, hasMore
+	}
+	if hasNext {
+		nextCursor, err := r.cursors.Encode(cursorQuery, CursorNext, items[len(items)-1])
 		if err != nil {
 			return nil, err
 		}
 		listPostsResult.NextCursor = nextCursor
 	}
+	if hasPrev {
+		prevCursor, err := r.cursors.Encode(cursorQuery, CursorPrev, items[0])
+		if err != nil {
+			return nil, err
+		}
+		listPostsResult.PrevCursor = prevCursor
+	}
 	return listPostsResult, nil
 }
+
+// CountPosts returns the maintained number of posts, or of posts in a tag
+func (r *BlogRepository) CountPosts(ctx context.Context, tag string) (int, error) {
+	result, err := r.Db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]dynamoType.AttributeValue{
+			"PK": &dynamoType.AttributeValueMemberS{Value: "COUNTER"},
+			"SK": &dynamoType.AttributeValueMemberS{Value: postsPartitionKey(tag)},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if result.Item == nil {
+		return 0, nil
+	}
+	var counter struct {
+		Count int `dynamodbav:"count"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &counter); err != nil {
+		return 0, err
+	}
+	return counter.Count, nil
+}
+
+// RebuildCounters recounts every post partition and overwrites the maintained counters,
+// used after bulk writes and to seed counters on tables written before they existed
+func (r *BlogRepository) RebuildCounters(ctx context.Context) error {
+	db := r.Db
+	tableName := r.tableName
+	tags, err := r.GetTags(ctx)
+	if err != nil {
+		return err
+	}
+	partitions := []string{postsPartitionKey("")}
+	for _, tag := range *tags {
+		partitions = append(partitions, postsPartitionKey(tag.Tag))
+	}
+	for _, partition := range partitions {
+		count, err := r.countPartition(ctx, partition)
+		if err != nil {
+			return err
+		}
+		_, err = db.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: &tableName,
+			Item: map[string]dynamoType.AttributeValue{
+				"PK":    &dynamoType.AttributeValueMemberS{Value: "COUNTER"},
+				"SK":    &dynamoType.AttributeValueMemberS{Value: partition},
+				"count": &dynamoType.AttributeValueMemberN{Value: strconv.Itoa(count)},
+				"Type":  &dynamoType.AttributeValueMemberS{Value: "COUNTER"},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *BlogRepository) countPartition(ctx context.Context, pk string) (int, error) {
+	paginator := dynamodb.NewQueryPaginator(r.Db, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		IndexName:              aws.String("LSI1"),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]dynamoType.AttributeValue{
+			":pk": &dynamoType.AttributeValueMemberS{Value: pk},
+		},
+		Select: dynamoType.SelectCount,
+	})
+	count := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, err
+		}
+		count += int(page.Count)
+	}
+	return count, nil
+}
+
+// GetPost returns a single post by slug, including its body, served from the read cache when possible
+func (r *BlogRepository) GetPost(ctx context.Context, slug string) (*Post, error) {
+	post, err := cachedRead(ctx, r.cache, "post:"+slug, func(ctx context.Context) (*Post, error) {
+		return r.queryPost(ctx, slug)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := *post
+	return &result, nil
+}
+
+func (r *BlogRepository) queryPost(ctx context.Context, slug string) (*Post, error) {
+	addSurrogateKeys(ctx, postKey(slug))
+	post, err := r.getPostItem(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, &NotFoundError{Resource: "post", Key: slug}
+	}
+	post.Body, err = r.getPostBody(ctx, *post)
+	if err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// GetNeighbours returns the posts published right before and after a post,
+// when tag is set only posts of that tag are considered
+func (r *BlogRepository) GetNeighbours(ctx context.Context, slug, tag string) (*PostNeighbours, error) {
+	post, err := r.getPostItem(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, &NotFoundError{Resource: "post", Key: slug}
+	}
+	if tag != "" && !slices.Contains(post.Tags, tag) {
+		return nil, &NotFoundError{Resource: "post", Key: fmt.Sprintf("%s in tag %s", slug, tag)}
+	}
+	pk := postsPartitionKey(tag)
+	sortKey := postSortKey(*post)
+	previous, err := r.adjacentPost(ctx, pk, "SK_LSI1 < :sk", sortKey, false)
+	if err != nil {
+		return nil, err
+	}
+	next, err := r.adjacentPost(ctx, pk, "SK_LSI1 > :sk", sortKey, true)
+	if err != nil {
+		return nil, err
+	}
+	// a new post may become a neighbour, so neighbours are tagged as a listing
+	addSurrogateKeys(ctx, postKey(slug), listPostsKey)
+	for _, neighbour := range []*Post{previous, next} {
+		if neighbour != nil {
+			addSurrogateKeys(ctx, postKey(neighbour.Slug))
+		}
+	}
+	return &PostNeighbours{Previous: previous, Next: next}, nil
+}
+
+// adjacentPost returns the first post of a partition matching the LSI1 sort key condition, or nil
+func (r *BlogRepository) adjacentPost(ctx context.Context, pk, skCondition, sortKey string, forward bool) (*Post, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		IndexName:              aws.String("LSI1"),
+		KeyConditionExpression: aws.String("PK = :pk AND " + skCondition),
+		ExpressionAttributeValues: map[string]dynamoType.AttributeValue{
+			":pk": &dynamoType.AttributeValueMemberS{Value: pk},
+			":sk": &dynamoType.AttributeValueMemberS{Value: sortKey},
+		},
+		ScanIndexForward: aws.Bool(forward),
+		Limit:            aws.Int32(1),
+	}
+	projectPostListing(input)
+	result, err := r.Db.Query(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		return nil, nil
+	}
+	var post Post
+	if err := attributevalue.UnmarshalMap(result.Items[0], &post); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// GetSeries returns the posts of a series in series order
+func (r *BlogRepository) GetSeries(ctx context.Context, series string) (*SeriesPosts, error) {
+	paginator := dynamodb.NewQueryPaginator(r.Db, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		IndexName:              aws.String("LSI2"),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]dynamoType.AttributeValue{
+			":pk": &dynamoType.AttributeValueMemberS{Value: seriesPartitionKey(series)},
+		},
+		ScanIndexForward: aws.Bool(true),
+	})
+	posts := []Post{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			var post Post
+			if err := attributevalue.UnmarshalMap(item, &post); err != nil {
+				return nil, err
+			}
+			posts = append(posts, post)
+		}
+	}
+	if len(posts) == 0 {
+		return nil, &NotFoundError{Resource: "series", Key: series}
+	}
+	addSurrogateKeys(ctx, seriesKey(series))
+	addSurrogateKeys(ctx, postKeys(posts)...)
+	return &SeriesPosts{Series: series, Items: posts}, nil
+}
+
+// GetTags returns every tag with its number of posts, served from the read cache when possible
 func (r *BlogRepository) GetTags(ctx context.Context) (*[]TagWithCount, error) {
+	tags, err := cachedRead(ctx, r.cache, "tags", r.queryTags)
+	if err != nil {
+		return nil, err
+	}
+	result := slices.Clone(*tags)
+	return &result, nil
+}
+
+func (r *BlogRepository) queryTags(ctx context.Context) (*[]TagWithCount, error) {
+	addSurrogateKeys(ctx, listTagsKey)
 	db := r.Db
 	tableName := r.tableName
 	// Define the initial query to fetch all tag slugs
@@ -374,7 +682,8 @@ func (r *BlogRepository) GetTags(ctx context.Context) (*[]TagWithCount, error) {
 
 }
 
-func (r *BlogRepository) DeletePost(ctx context.Context, slug string) error {
+// DeletePost deletes a post with its mappings and body, it returns the deleted post
+func (r *BlogRepository) DeletePost(ctx context.Context, slug string) (*Post, error) {
 	db := r.Db
 	tableName := r.tableName
 	// Fetch the post from the database to get the tags
@@ -389,12 +698,12 @@ func (r *BlogRepository) DeletePost(ctx context.Context, slug string) error {
 	result, err := db.GetItem(ctx, getItemInput)
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to get post", "Slug", slug, "Error", err)
-		return err
+		return nil, err
 	}
 
 	if result.Item == nil {
 		slog.ErrorContext(ctx, "Post not found", "Slug", slug)
-		return errors.New("post not found")
+		return nil, &NotFoundError{Resource: "post", Key: slug}
 	}
 
 	// Extract the tags from the item
@@ -402,13 +711,13 @@ func (r *BlogRepository) DeletePost(ctx context.Context, slug string) error {
 	err = attributevalue.UnmarshalMap(result.Item, &post)
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to unmarshal post", "Slug", slug, "Error", err)
-		return err
+		return nil, err
 	}
 
 	// Begin Transaction for deleting Post and Tag-Post Mappings
 	var transactItems []dynamoType.TransactWriteItem
 
-	// Delete Post item
+	// Delete Post item, guarded so a concurrent delete can't decrement the counters twice
 	deletePostItem := dynamoType.TransactWriteItem{
 		Delete: &dynamoType.Delete{
 			TableName: aws.String(tableName),
@@ -416,10 +725,11 @@ func (r *BlogRepository) DeletePost(ctx context.Context, slug string) error {
 				"PK": &dynamoType.AttributeValueMemberS{Value: "POST"},
 				"SK": &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("POST#%s", slug)},
 			},
+			ConditionExpression: aws.String("attribute_exists(PK)"),
 		},
 	}
 
-	transactItems = append(transactItems, deletePostItem)
+	transactItems = append(transactItems, deletePostItem, counterUpdate(tableName, postsPartitionKey(""), -1))
 
 	// Delete Tag-Post mappings
 	for _, tag := range post.Tags {
@@ -432,21 +742,32 @@ func (r *BlogRepository) DeletePost(ctx context.Context, slug string) error {
 				},
 			},
 		}
-		transactItems = append(transactItems, deleteMapping)
+		transactItems = append(transactItems, deleteMapping, counterUpdate(tableName, postsPartitionKey(tag), -1))
+	}
+	if post.Series != "" {
+		transactItems = append(transactItems, deleteSeriesItem(tableName, post))
 	}
 
 	// Execute Transaction
 	_, err = db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: transactItems,
 	})
+	if isConditionFailure(err) {
+		return nil, &NotFoundError{Resource: "post", Key: slug}
+	}
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to transact delete items", "Error", err)
-		return err
+		return nil, err
 	}
-	return nil
+	r.invalidateReads(slug)
+	if err := r.pruneBodyChunks(ctx, slug, ""); err != nil {
+		return nil, err
+	}
+	return &post, r.RefreshRelatedAround(ctx, slug, post.Tags)
 }
 
-func (r *BlogRepository) InvalidateCdnCache(ctx context.Context, path string) error {
+// InvalidateCdnCache purges paths from CloudFront and returns the ID of the invalidation
+func (r *BlogRepository) InvalidateCdnCache(ctx context.Context, paths ...string) (string, error) {
 	distributionID := r.cloudfrontDistroId
 	cdn := r.cdn
 	// Generate a unique caller reference
@@ -458,8 +779,8 @@ func (r *BlogRepository) InvalidateCdnCache(ctx context.Context, path string) er
 		InvalidationBatch: &cloudfrontType.InvalidationBatch{
 			CallerReference: &callerReference,
 			Paths: &cloudfrontType.Paths{
-				Quantity: aws.Int32(1),
-				Items:    []string{path},
+				Quantity: aws.Int32(int32(len(paths))),
+				Items:    paths,
 			},
 		},
 	}
@@ -467,77 +788,252 @@ func (r *BlogRepository) InvalidateCdnCache(ctx context.Context, path string) er
 	// Send the invalidation request
 	output, err := cdn.CreateInvalidation(ctx, invalidationInput)
 	if err != nil {
-		return fmt.Errorf("failed to create invalidation: %w", err)
+		return "", fmt.Errorf("failed to create invalidation: %w", err)
 	}
 
 	// Log or return the invalidation details
 	slog.InfoContext(ctx, "Invalidation created", "InvalidationID", *output.Invalidation.Id)
-	return nil
+	return *output.Invalidation.Id, nil
 
 }
-func stringSliceToDynamoDB(slice []string) []dynamoType.AttributeValue {
-	var avList []dynamoType.AttributeValue
-	for _, tag := range slice {
-		avList = append(avList, &dynamoType.AttributeValueMemberS{Value: tag})
+
+// isConditionFailure tells whether a transaction was cancelled because a condition check failed
+func isConditionFailure(err error) bool {
+	var cancelled *dynamoType.TransactionCanceledException
+	if !errors.As(err, &cancelled) {
+		return false
 	}
-	return avList
+	for _, reason := range cancelled.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
 }
 
-// Cursor represents the pagination cursor with PK and SK as strings
-type Cursor struct {
-	PK     string `json:"PK"`
-	SK     string `json:"SK"`
-	SKLSI1 string `json:"SK_LSI1"`
+// invalidateReads drops the cached reads a write to a post changes, every listing is tagged with list:posts
+// so the tag a post joins or leaves doesn't matter
+func (r *BlogRepository) invalidateReads(slug string) {
+	r.cache.Invalidate(postKey(slug), listPostsKey, listTagsKey)
 }
 
-// encodeCursor encodes the ExclusiveStartKey into a base64 string
-func encodeCursor(key map[string]dynamoType.AttributeValue) (string, error) {
-	slog.Info("key", "key", key)
-	pkAttr, ok := key["PK"].(*dynamoType.AttributeValueMemberS)
-	if !ok {
-		return "", errors.New("invalid cursor: missing or invalid PK")
+// getPostItem fetches the POST item of a slug, returning nil when it doesn't exist
+func (r *BlogRepository) getPostItem(ctx context.Context, slug string) (*Post, error) {
+	result, err := r.Db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]dynamoType.AttributeValue{
+			"PK": &dynamoType.AttributeValueMemberS{Value: "POST"},
+			"SK": &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("POST#%s", slug)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var post Post
+	if err := attributevalue.UnmarshalMap(result.Item, &post); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// postItem builds the item stored for a post in the given partition, "POST" or a "TAG#" partition
+func postItem(post Post, pk, itemType string) map[string]dynamoType.AttributeValue {
+	item := map[string]dynamoType.AttributeValue{
+		"PK":          &dynamoType.AttributeValueMemberS{Value: pk},
+		"SK":          &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("POST#%s", post.Slug)},
+		"SK_LSI1":     &dynamoType.AttributeValueMemberS{Value: postSortKey(post)},
+		"title":       &dynamoType.AttributeValueMemberS{Value: post.Title},
+		"tags":        &dynamoType.AttributeValueMemberL{Value: stringSliceToDynamoDB(post.Tags)},
+		"created_at":  &dynamoType.AttributeValueMemberS{Value: post.CreatedAt},
+		"description": &dynamoType.AttributeValueMemberS{Value: post.Description},
+		"slug":        &dynamoType.AttributeValueMemberS{Value: post.Slug},
+		"Type":        &dynamoType.AttributeValueMemberS{Value: itemType},
 	}
-	skAttr, ok := key["SK"].(*dynamoType.AttributeValueMemberS)
-	if !ok {
-		return "", errors.New("invalid cursor: missing or invalid SK")
+	if post.UpdatedAt != "" {
+		item["updated_at"] = &dynamoType.AttributeValueMemberS{Value: post.UpdatedAt}
 	}
-	sklsi1Attr, ok := key["SK_LSI1"].(*dynamoType.AttributeValueMemberS)
-	if !ok {
-		return "", errors.New("invalid cursor: missing or invalid SK_LSI1")
+	if post.Series != "" {
+		item["series"] = &dynamoType.AttributeValueMemberS{Value: post.Series}
+		item["series_order"] = &dynamoType.AttributeValueMemberN{Value: strconv.Itoa(post.SeriesOrder)}
 	}
-	cursor := Cursor{
-		PK:     pkAttr.Value,
-		SK:     skAttr.Value,
-		SKLSI1: sklsi1Attr.Value,
+	if post.WordCount > 0 {
+		item["word_count"] = &dynamoType.AttributeValueMemberN{Value: strconv.Itoa(post.WordCount)}
+		item["reading_time"] = &dynamoType.AttributeValueMemberN{Value: strconv.Itoa(post.ReadingTime)}
 	}
+	return item
+}
 
-	marshaled, err := json.Marshal(cursor)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal cursor: %w", err)
+// postListingAttributes are the attributes of the posts read by listings, keys included for cursors.
+// The table of contents is only stored on the POST item and served by the single post endpoint
+var postListingAttributes = []string{
+	"PK", "SK", "SK_LSI1", "slug", "title", "tags", "created_at", "updated_at", "description",
+	"series", "series_order", "word_count", "reading_time", "body_sha256", "body_chunks",
+}
+
+// projectPostListing limits a query of a posts partition to the listing attributes
+func projectPostListing(input *dynamodb.QueryInput) {
+	if input.ExpressionAttributeNames == nil {
+		input.ExpressionAttributeNames = map[string]string{}
+	}
+	names := make([]string, 0, len(postListingAttributes))
+	for _, attribute := range postListingAttributes {
+		input.ExpressionAttributeNames["#"+attribute] = attribute
+		names = append(names, "#"+attribute)
 	}
+	input.ProjectionExpression = aws.String(strings.Join(names, ", "))
+}
 
-	encoded := base64.StdEncoding.EncodeToString(marshaled)
-	return encoded, nil
+// postChanged tells whether a write changes the stored post, bodyHash is the hash of the body being written
+func postChanged(existing, post Post, bodyHash string) bool {
+	return existing.Title != post.Title ||
+		existing.Description != post.Description ||
+		existing.CreatedAt != post.CreatedAt ||
+		existing.Series != post.Series ||
+		existing.SeriesOrder != post.SeriesOrder ||
+		!slices.Equal(existing.Tags, post.Tags) ||
+		existing.BodyHash != bodyHash
 }
 
-// decodeCursor decodes the base64 encoded cursor into a map[string]dynamoType.AttributeValue
-func decodeCursor(cursor string) (map[string]dynamoType.AttributeValue, error) {
-	decoded, err := base64.StdEncoding.DecodeString(cursor)
-	if err != nil {
-		return nil, errors.New("invalid cursor encoding")
+// postSortKey is the LSI1 sort key ordering posts by creation date. created_at is either a date or a timestamp
+// with any offset, timestamps are keyed in UTC so they compare with each other and with date ranges, dates are
+// kept as they are and sort before the timestamps of their day. Posts are rekeyed as they're written, hard syncs
+// rekey every post written before
+func postSortKey(post Post) string {
+	return fmt.Sprintf("CREATED_AT#%s#POST#%s", createdAtSortValue(post.CreatedAt), post.Slug)
+}
+
+func createdAtSortValue(createdAt string) string {
+	if timestamp, err := time.Parse(time.RFC3339, createdAt); err == nil {
+		return timestamp.UTC().Format(time.RFC3339)
+	}
+	return createdAt
+}
+
+// seriesItem builds the Series-Post mapping, SK_LSI2 holds the position in the series
+func seriesItem(post Post) map[string]dynamoType.AttributeValue {
+	item := postItem(post, seriesPartitionKey(post.Series), "SERIES_POST")
+	item["SK_LSI2"] = &dynamoType.AttributeValueMemberS{Value: rankSortKey(post.SeriesOrder)}
+	return item
+}
+
+// rankSortKey is the LSI2 sort key of a position, SK_LSI2 is a string attribute so positions are zero padded to sort
+func rankSortKey(position int) string {
+	return fmt.Sprintf("%06d", position)
+}
+
+func deleteSeriesItem(tableName string, post Post) dynamoType.TransactWriteItem {
+	return dynamoType.TransactWriteItem{
+		Delete: &dynamoType.Delete{
+			TableName: aws.String(tableName),
+			Key: map[string]dynamoType.AttributeValue{
+				"PK": &dynamoType.AttributeValueMemberS{Value: seriesPartitionKey(post.Series)},
+				"SK": &dynamoType.AttributeValueMemberS{Value: fmt.Sprintf("POST#%s", post.Slug)},
+			},
+		},
+	}
+}
+
+func seriesPartitionKey(series string) string {
+	return fmt.Sprintf("SERIES#%s", series)
+}
+
+func tagMetadataItem(tag string) map[string]dynamoType.AttributeValue {
+	return map[string]dynamoType.AttributeValue{
+		"PK":   &dynamoType.AttributeValueMemberS{Value: "TAG"},
+		"SK":   &dynamoType.AttributeValueMemberS{Value: "TAG#" + tag},
+		"slug": &dynamoType.AttributeValueMemberS{Value: tag},
+		"Type": &dynamoType.AttributeValueMemberS{Value: "TAG"},
+	}
+}
+
+// counterUpdate adds delta to the counter of a post partition
+func counterUpdate(tableName, partition string, delta int) dynamoType.TransactWriteItem {
+	return dynamoType.TransactWriteItem{
+		Update: &dynamoType.Update{
+			TableName: aws.String(tableName),
+			Key: map[string]dynamoType.AttributeValue{
+				"PK": &dynamoType.AttributeValueMemberS{Value: "COUNTER"},
+				"SK": &dynamoType.AttributeValueMemberS{Value: partition},
+			},
+			UpdateExpression: aws.String("ADD #count :delta SET #type = :type"),
+			ExpressionAttributeNames: map[string]string{
+				"#count": "count",
+				"#type":  "Type",
+			},
+			ExpressionAttributeValues: map[string]dynamoType.AttributeValue{
+				":delta": &dynamoType.AttributeValueMemberN{Value: strconv.Itoa(delta)},
+				":type":  &dynamoType.AttributeValueMemberS{Value: "COUNTER"},
+			},
+		},
+	}
+}
+
+func stringSliceToDynamoDB(slice []string) []dynamoType.AttributeValue {
+	var avList []dynamoType.AttributeValue
+	for _, tag := range slice {
+		avList = append(avList, &dynamoType.AttributeValueMemberS{Value: tag})
 	}
+	return avList
+}
 
-	var c Cursor
-	if err := json.Unmarshal(decoded, &c); err != nil {
-		slog.Error("Failed to unmarshal cursor", "Error", err)
-		return nil, errors.New("invalid cursor format")
+// postsPartitionKey returns the partition listing all posts, or only the posts of a tag
+func postsPartitionKey(tag string) string {
+	if tag != "" {
+		return fmt.Sprintf("TAG#%s", tag)
 	}
+	return "POST"
+}
 
-	key := map[string]dynamoType.AttributeValue{
-		"PK":      &dynamoType.AttributeValueMemberS{Value: c.PK},
-		"SK":      &dynamoType.AttributeValueMemberS{Value: c.SK},
-		"SK_LSI1": &dynamoType.AttributeValueMemberS{Value: c.SKLSI1},
+// loadCursorSecret reads the HMAC key used to sign pagination cursors,
+// outside production a random key is used so cursors only survive the current instance
+func loadCursorSecret() ([]byte, error) {
+	secret := os.Getenv("CURSOR_SECRET")
+	if secret != "" {
+		return []byte(secret), nil
+	}
+	if os.Getenv("ENVIRONMENT") == "production" {
+		return nil, errors.New("CURSOR_SECRET is required in production")
+	}
+	slog.Warn("CURSOR_SECRET not set, using an ephemeral key")
+	randomSecret := make([]byte, 32)
+	if _, err := rand.Read(randomSecret); err != nil {
+		return nil, err
 	}
+	return randomSecret, nil
+}
+
+const (
+	// maxBatchWriteAttempts bounds the attempts at writing the unprocessed items of a batch
+	maxBatchWriteAttempts = 8
+	batchWriteBaseDelay   = 50 * time.Millisecond
+)
 
-	return key, nil
+// batchWrite sends write requests in batches of 25, the BatchWriteItem maximum, retrying unprocessed items
+// with exponential backoff and full jitter as they're left over when the table is throttled
+func (r *BlogRepository) batchWrite(ctx context.Context, requests []dynamoType.WriteRequest) error {
+	for start := 0; start < len(requests); start += 25 {
+		pending := map[string][]dynamoType.WriteRequest{r.tableName: requests[start:min(start+25, len(requests))]}
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == maxBatchWriteAttempts {
+				return fmt.Errorf("%d write requests left unprocessed after %d attempts", len(pending[r.tableName]), attempt)
+			}
+			if attempt > 0 {
+				delay := time.Duration(mathrand.Int64N(int64(batchWriteBaseDelay << attempt)))
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(delay):
+				}
+			}
+			result, err := r.Db.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return err
+			}
+			pending = result.UnprocessedItems
+		}
+	}
+	return nil
 }
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func testPost(slug, createdAt string, tags ...string) Post {
+	return Post{Slug: slug, Title: slug, Description: slug, CreatedAt: createdAt, Tags: tags}
+}
+
+func TestPostCountersFollowWrites(t *testing.T) {
+	ctx := context.Background()
+	fake, repository := newFakeDynamo(t)
+	expectCounters := func(step string, want map[string]int) {
+		t.Helper()
+		for partition, count := range want {
+			if got := fake.counter(partition); got != count {
+				t.Errorf("%s: expected counter %s to be %d, got %d", step, partition, count, got)
+			}
+		}
+	}
+
+	for _, post := range []Post{testPost("a", "2024-01-01", "go", "aws"), testPost("b", "2024-01-02", "go")} {
+		if _, err := repository.UpsertPost(ctx, post); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	expectCounters("insert", map[string]int{"POST": 2, "TAG#go": 2, "TAG#aws": 1})
+
+	// updating without a change of tags leaves the counters alone
+	if _, err := repository.UpsertPost(ctx, testPost("b", "2024-01-02", "go")); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expectCounters("update", map[string]int{"POST": 2, "TAG#go": 2, "TAG#aws": 1})
+
+	if _, err := repository.UpsertPost(ctx, testPost("a", "2024-01-01", "aws", "k8s")); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expectCounters("retag", map[string]int{"POST": 2, "TAG#go": 1, "TAG#aws": 1, "TAG#k8s": 1})
+	if got := fake.partition("TAG#go"); !slices.Equal(got, []string{"POST#b"}) {
+		t.Errorf("expected the dropped tag mapping to be removed, got %v", got)
+	}
+
+	if _, err := repository.DeletePost(ctx, "b"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expectCounters("delete", map[string]int{"POST": 1, "TAG#go": 0, "TAG#aws": 1, "TAG#k8s": 1})
+	if _, err := repository.DeletePost(ctx, "b"); err == nil {
+		t.Errorf("expected deleting a missing post to fail")
+	}
+	expectCounters("repeated delete", map[string]int{"POST": 1, "TAG#go": 0})
+
+	// the rebuild recounts the partitions, so it agrees with the maintained counters
+	controller := &BlogController{repository: repository}
+	for _, tag := range []string{"", "aws"} {
+		result, err := controller.listPosts(ctx, ListPostsQuery{Limit: 6, Tag: tag, Sort: SortDesc, Count: true})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if result.Total == nil || *result.Total != 1 {
+			t.Errorf("expected a total of 1 posts in %q, got %v", tag, result.Total)
+		}
+	}
+	fake.items["COUNTER"]["POST"]["count"] = map[string]any{"N": "42"}
+	delete(fake.items["COUNTER"], "TAG#k8s")
+	if err := repository.RebuildCounters(ctx); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expectCounters("rebuild", map[string]int{"POST": 1, "TAG#go": 0, "TAG#aws": 1, "TAG#k8s": 1})
+}
+
+func TestListPostsCursors(t *testing.T) {
+	ctx := context.Background()
+	_, repository := newFakeDynamo(t)
+	for _, post := range []Post{
+		testPost("a", "2024-01-01", "go"),
+		testPost("b", "2024-01-02", "go"),
+		testPost("c", "2024-01-03", "go"),
+		testPost("d", "2024-01-04", "go"),
+		testPost("e", "2024-01-05", "go"),
+	} {
+		if _, err := repository.UpsertPost(ctx, post); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	query := ListPostsQuery{Limit: 2, Tag: "go", Sort: SortDesc}
+	page := func(cursor string) *ListPosts {
+		t.Helper()
+		query.Cursor = cursor
+		result, err := repository.GetPosts(ctx, query)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return result
+	}
+	expect := func(step string, result *ListPosts, want []string, hasNext, hasPrev bool) {
+		t.Helper()
+		if got := postSlugs(result.Items); !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", step, want, got)
+		}
+		if (result.NextCursor != "") != hasNext || (result.PrevCursor != "") != hasPrev {
+			t.Errorf("%s: expected next %t and prev %t, got %q and %q", step, hasNext, hasPrev, result.NextCursor, result.PrevCursor)
+		}
+	}
+
+	first := page("")
+	expect("first", first, []string{"e", "d"}, true, false)
+	second := page(first.NextCursor)
+	expect("second", second, []string{"c", "b"}, true, true)
+	last := page(second.NextCursor)
+	expect("last", last, []string{"a"}, false, true)
+	// walking back keeps the page order and ends on the first page without a previous cursor
+	back := page(last.PrevCursor)
+	expect("back to second", back, []string{"c", "b"}, true, true)
+	expect("back to first", page(back.PrevCursor), []string{"e", "d"}, true, false)
+}
+
+func TestGetNeighbours(t *testing.T) {
+	ctx := context.Background()
+	_, repository := newFakeDynamo(t)
+	for _, post := range []Post{
+		testPost("a", "2024-01-01", "go"),
+		testPost("b", "2024-01-02", "aws"),
+		testPost("c", "2024-01-03", "go"),
+		testPost("d", "2024-01-04", "aws"),
+	} {
+		if _, err := repository.UpsertPost(ctx, post); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	slugOf := func(post *Post) string {
+		if post == nil {
+			return ""
+		}
+		return post.Slug
+	}
+
+	cases := map[string]struct {
+		slug, tag      string
+		previous, next string
+		notFound       bool
+	}{
+		"middle":         {slug: "b", previous: "a", next: "c"},
+		"first":          {slug: "a", next: "b"},
+		"last":           {slug: "d", previous: "c"},
+		"within a tag":   {slug: "c", tag: "go", previous: "a"},
+		"first of a tag": {slug: "b", tag: "aws", next: "d"},
+		"not in the tag": {slug: "b", tag: "go", notFound: true},
+		"missing post":   {slug: "z", notFound: true},
+	}
+	for name, tc := range cases {
+		neighbours, err := repository.GetNeighbours(ctx, tc.slug, tc.tag)
+		if tc.notFound {
+			if _, ok := err.(*NotFoundError); !ok {
+				t.Errorf("%s: expected a NotFoundError, got %v", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if slugOf(neighbours.Previous) != tc.previous || slugOf(neighbours.Next) != tc.next {
+			t.Errorf("%s: expected %q and %q, got %q and %q", name, tc.previous, tc.next, slugOf(neighbours.Previous), slugOf(neighbours.Next))
+		}
+	}
+}
+
+func TestGetSeries(t *testing.T) {
+	ctx := context.Background()
+	fake, repository := newFakeDynamo(t)
+	inSeries := func(post Post, series string, order int) Post {
+		post.Series, post.SeriesOrder = series, order
+		return post
+	}
+	// series order, not creation date, orders the series, and positions sort past 9
+	for _, post := range []Post{
+		inSeries(testPost("intro", "2024-03-01", "go"), "go-basics", 1),
+		inSeries(testPost("closing", "2024-01-01", "go"), "go-basics", 10),
+		inSeries(testPost("types", "2024-02-01", "go"), "go-basics", 2),
+	} {
+		if _, err := repository.UpsertPost(ctx, post); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	series, err := repository.GetSeries(ctx, "go-basics")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := postSlugs(series.Items); !slices.Equal(got, []string{"intro", "types", "closing"}) {
+		t.Errorf("unexpected series order %v", got)
+	}
+
+	if _, err := repository.UpsertPost(ctx, inSeries(testPost("types", "2024-02-01", "go"), "go-types", 1)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := fake.partition("SERIES#go-basics"); slices.Contains(got, "POST#types") {
+		t.Errorf("expected the moved post to leave its previous series, got %v", got)
+	}
+	series, err = repository.GetSeries(ctx, "go-types")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := postSlugs(series.Items); !slices.Equal(got, []string{"types"}) {
+		t.Errorf("unexpected series %v", got)
+	}
+
+	if _, err := repository.DeletePost(ctx, "types"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := repository.GetSeries(ctx, "go-types"); err == nil {
+		t.Errorf("expected an emptied series to be not found")
+	}
+}
+
+func TestListPostsDateRangeAcrossOffsets(t *testing.T) {
+	ctx := context.Background()
+	_, repository := newFakeDynamo(t)
+	// early and late cross midnight once in UTC, day has no time and sorts before the timestamps of its day
+	for _, post := range []Post{
+		testPost("late", "2024-01-05T23:00:00-05:00", "go"),
+		testPost("day", "2024-01-06", "go"),
+		testPost("early", "2024-01-06T02:00:00+03:00", "go"),
+		testPost("next", "2024-01-07", "go"),
+	} {
+		if _, err := repository.UpsertPost(ctx, post); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	cases := map[string]struct {
+		from, to string
+		want     []string
+	}{
+		"every post":     {want: []string{"early", "day", "late", "next"}},
+		"a single day":   {from: "2024-01-06", to: "2024-01-06", want: []string{"day", "late"}},
+		"up to a day":    {to: "2024-01-05", want: []string{"early"}},
+		"from a day":     {from: "2024-01-07", want: []string{"next"}},
+		"an empty range": {from: "2024-01-08", want: nil},
+	}
+	for name, tc := range cases {
+		result, err := repository.GetPosts(ctx, ListPostsQuery{Limit: 6, Sort: SortAsc, From: tc.from, To: tc.to})
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if got := postSlugs(result.Items); !slices.Equal(got, tc.want) && len(got)+len(tc.want) > 0 {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, got)
+		}
+	}
+	post, err := repository.GetPost(ctx, "late")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if post.CreatedAt != "2024-01-05T23:00:00-05:00" {
+		t.Errorf("expected created_at to be returned as sent, got %q", post.CreatedAt)
+	}
+}
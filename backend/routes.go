@@ -0,0 +1,227 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Route describes an endpoint, both the router and the OpenAPI document are built from the route table
+// so they can't drift apart
+type Route struct {
+	Method      string
+	Path        string // gin syntax relative to the API root e.g. /posts/:slug
+	OperationID string
+	Summary     string
+	Query       any    // struct bound from the query string, see ListPostsQuery
+	Body        any    // request body, a JSON DTO unless BodyType says otherwise
+	BodyType    string // content type of the request body, defaults to application/json
+	Response    any    // 200 response body, a JSON DTO unless ResponseType says otherwise
+	// ResponseType is the content type of the 200 response, defaults to application/json
+	ResponseType string
+	Security     string // security scheme the route requires, see openapiSecuritySchemes
+	Deprecated   bool
+	// Unversioned routes are served at the legacy root only and never deprecated, for URLs that must stay stable e.g. feeds
+	Unversioned bool
+	CachePolicy string // name of the cache policy of GET responses, see defaultCachePolicies
+	RateLimit   string // rate limit class of the route, see RateLimitClass
+	Middlewares []gin.HandlerFunc
+	Handler     gin.HandlerFunc
+}
+
+// Routes returns the route table of the blog API, see APIRoutes for the paths it's served at
+func (bc *BlogController) Routes() []Route {
+	return []Route{
+		{
+			Method: "GET", Path: "/posts", OperationID: "listPosts",
+			Summary: "List posts, newest first by default, optionally filtered by tag and creation date",
+			Query:   ListPostsQuery{}, Response: ListPosts{},
+			Handler: bc.GetPostsHandler,
+		},
+		{
+			Method: "GET", Path: "/posts/:slug", OperationID: "getPost",
+			Summary:  "Get a post along with its body",
+			Response: Post{},
+			Handler:  bc.GetPostHandler,
+		},
+		{
+			Method: "GET", Path: "/posts/:slug/neighbours", OperationID: "getPostNeighbours",
+			Summary: "Get the posts published right before and after a post",
+			Query:   NeighboursQuery{}, Response: PostNeighbours{},
+			Handler: bc.GetNeighboursHandler,
+		},
+		{
+			Method: "GET", Path: "/posts/:slug/related", OperationID: "getRelatedPosts",
+			Summary:  "Get the posts related to a post",
+			Response: []Post{},
+			Handler:  bc.GetRelatedHandler,
+		},
+		{
+			Method: "GET", Path: "/series/:series", OperationID: "getSeries",
+			Summary:  "Get the posts of a series in order",
+			Response: SeriesPosts{},
+			Handler:  bc.GetSeriesHandler,
+		},
+		{
+			Method: "GET", Path: "/tags", OperationID: "listTags",
+			Summary:  "List tags with their post counts",
+			Response: []TagWithCount{},
+			Handler:  bc.GetTagsHandler,
+		},
+		{
+			Method: "PUT", Path: "/posts", OperationID: "upsertPost",
+			Summary: "Create or update a post",
+			Body:    Post{}, Response: MessageResponse{},
+			Handler: bc.UpsertPostHandler,
+		},
+		{
+			Method: "PUT", Path: "/posts/:slug/mdx", OperationID: "ingestMdx",
+			Summary: "Create or update a post from a raw MDX document with its frontmatter",
+			Body:    "", BodyType: "text/markdown", Response: MessageResponse{},
+			Handler: bc.IngestMdxHandler,
+		},
+		{
+			Method: "POST", Path: "/events/posts-updated", OperationID: "postsUpdatedEvent",
+			Summary: "Receive post events pushed by the GCP Pub/Sub subscription",
+			Body:    EventPostUpdatedRequest{}, Response: MessageResponse{},
+			Security:    "gcpPubSub",
+			Middlewares: []gin.HandlerFunc{bc.pubsubAuth.Middleware()},
+			Handler:     bc.PostsUpdatedGcpSubscriptionHandler,
+		},
+		{
+			Method: "POST", Path: "/events/cache-warm", OperationID: "cacheWarmEvent",
+			Summary: "Receive the cache warming messages of the SQS queue, once their invalidation completes",
+			Body:    QueueEvent{}, Response: QueueEventResponse{},
+			Handler: bc.CacheWarmEventHandler,
+		},
+		{
+			Method: "DELETE", Path: "/posts/:slug", OperationID: "deletePost",
+			Summary:  "Delete a post",
+			Response: MessageResponse{},
+			Handler:  bc.DeletePostHandler,
+		},
+		{
+			Method: "POST", Path: "/hardsync", OperationID: "hardSync",
+			Summary: "Upsert every post and rebuild counters and related posts",
+			Body:    HardSyncRequest{}, Response: MessageResponse{},
+			RateLimit: syncRateLimit,
+			Handler:   bc.HardSyncHandler,
+		},
+		{
+			Method: "GET", Path: "/graphql", OperationID: "graphqlQuery",
+			Summary: "Run a GraphQL query, send a persisted query hash in extensions for CDN cacheable responses",
+			Query:   GraphQLQuery{}, Response: GraphQLResponse{},
+			Handler: bc.GraphQLHandler,
+		},
+		{
+			Method: "POST", Path: "/graphql", OperationID: "graphqlRequest",
+			Summary: "Run a GraphQL query",
+			Body:    GraphQLRequest{}, Response: GraphQLResponse{},
+			RateLimit: readRateLimit,
+			Handler:   bc.GraphQLHandler,
+		},
+		{
+			Method: "GET", Path: "/feed.xml", OperationID: "getRssFeed",
+			Summary:  "Get the RSS 2.0 feed of the latest posts",
+			Response: "", ResponseType: rssContentType, Unversioned: true, CachePolicy: "feed",
+			Handler: bc.FeedHandler(rssFormat),
+		},
+		{
+			Method: "GET", Path: "/atom.xml", OperationID: "getAtomFeed",
+			Summary:  "Get the Atom feed of the latest posts",
+			Response: "", ResponseType: atomContentType, Unversioned: true, CachePolicy: "feed",
+			Handler: bc.FeedHandler(atomFormat),
+		},
+		{
+			Method: "GET", Path: "/feed.json", OperationID: "getJsonFeed",
+			Summary:  "Get the JSON Feed of the latest posts",
+			Response: JSONFeed{}, ResponseType: jsonFeedContentType, Unversioned: true, CachePolicy: "feed",
+			Handler: bc.FeedHandler(jsonFeedFormat),
+		},
+		{
+			Method: "GET", Path: "/tags/:tag/feed.xml", OperationID: "getTagRssFeed",
+			Summary:  "Get the RSS 2.0 feed of the latest posts of a tag",
+			Response: "", ResponseType: rssContentType, Unversioned: true, CachePolicy: "feed",
+			Handler: bc.FeedHandler(rssFormat),
+		},
+		{
+			Method: "GET", Path: "/tags/:tag/atom.xml", OperationID: "getTagAtomFeed",
+			Summary:  "Get the Atom feed of the latest posts of a tag",
+			Response: "", ResponseType: atomContentType, Unversioned: true, CachePolicy: "feed",
+			Handler: bc.FeedHandler(atomFormat),
+		},
+		{
+			Method: "GET", Path: "/tags/:tag/feed.json", OperationID: "getTagJsonFeed",
+			Summary:  "Get the JSON Feed of the latest posts of a tag",
+			Response: JSONFeed{}, ResponseType: jsonFeedContentType, Unversioned: true, CachePolicy: "feed",
+			Handler: bc.FeedHandler(jsonFeedFormat),
+		},
+		{
+			Method: "GET", Path: "/sitemap.xml", OperationID: "getSitemap",
+			Summary:  "Get the sitemap of posts and tag pages, an index of sitemap pages past 50,000 URLs",
+			Response: "", ResponseType: sitemapContentType, Unversioned: true, CachePolicy: "feed",
+			Handler: bc.SitemapHandler,
+		},
+		{
+			Method: "GET", Path: "/sitemaps/:page", OperationID: "getSitemapPage",
+			Summary:  "Get a page of the sitemap index e.g. 2.xml",
+			Response: "", ResponseType: sitemapContentType, Unversioned: true, CachePolicy: "feed",
+			Handler: bc.SitemapPageHandler,
+		},
+		{
+			Method: "GET", Path: "/openapi.json", OperationID: "getOpenAPI",
+			Summary:  "Get this OpenAPI document",
+			Response: map[string]any{}, CachePolicy: "docs",
+			Handler: bc.OpenAPIHandler,
+		},
+		{
+			Method: "GET", Path: "/docs", OperationID: "getDocs",
+			Summary:  "Browse the API reference rendered from the OpenAPI document",
+			Response: "", ResponseType: "text/html", CachePolicy: "docs",
+			Handler: bc.DocsHandler,
+		},
+	}
+}
+
+// RateLimitClass is the budget the route's requests are counted against, reads and writes by default
+func (r Route) RateLimitClass() string {
+	if r.RateLimit != "" {
+		return r.RateLimit
+	}
+	if r.Method == http.MethodGet {
+		return readRateLimit
+	}
+	return writeRateLimit
+}
+
+// Handlers returns the middlewares of the route, the contract validation then the handler,
+// validation runs after route middlewares so e.g. unauthenticated requests are still rejected as such
+func (r Route) Handlers(contract gin.HandlerFunc) []gin.HandlerFunc {
+	return append(slices.Clip(r.Middlewares), contract, r.Handler)
+}
+
+// NewRouter builds the gin engine serving the route table behind the global middlewares
+func NewRouter(bc *BlogController) *gin.Engine {
+	router := gin.New()
+	routes := APIRoutes(bc.Routes())
+	// Register Global middlewares
+	router.Use(OtelGinMiddleware())
+	router.Use(NewCorsPolicyFromEnv().Middleware())
+	cachePolicies := NewCachePolicies(routes)
+	router.Use(cachePolicies.Middleware())
+	router.Use(bc.surrogateKeys.Middleware(routes, cachePolicies))
+	router.Use(CompressionMiddleware())
+	router.Use(ProblemMiddleware())
+	// Register endpoints
+	contract := NewContractValidator(bc.openapi()).Middleware()
+	for _, route := range routes {
+		limit := bc.rateLimiter.Middleware(route.RateLimitClass())
+		router.Handle(route.Method, route.Path, append([]gin.HandlerFunc{limit}, route.Handlers(contract)...)...)
+	}
+	bc.registerConnect(router)
+	router.NoRoute(func(c *gin.Context) {
+		abortWithError(c, &NotFoundError{Resource: "route", Key: c.Request.URL.Path})
+	})
+	return router
+}
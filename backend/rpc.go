@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	blogv1 "cloudificando/gen/cloudificando/blog/v1"
+	"cloudificando/gen/cloudificando/blog/v1/blogv1connect"
+
+	"connectrpc.com/connect"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// connectPrefix is where the Connect service is mounted, clients use https://<domain>/blog/connect as their base URL.
+// The protobuf package is versioned so the service isn't mounted under the API version roots
+const connectPrefix = "/blog/connect"
+
+// connectProcedures maps each procedure to the REST operation it mirrors, procedures are served behind
+// the middlewares and rate limit of that operation so both APIs share the same auth and budgets
+var connectProcedures = []struct {
+	Procedure   string
+	OperationID string
+}{
+	{blogv1connect.BlogServiceListPostsProcedure, "listPosts"},
+	{blogv1connect.BlogServiceGetPostProcedure, "getPost"},
+	{blogv1connect.BlogServiceListTagsProcedure, "listTags"},
+	{blogv1connect.BlogServiceUpsertPostProcedure, "upsertPost"},
+	{blogv1connect.BlogServiceDeletePostProcedure, "deletePost"},
+	{blogv1connect.BlogServiceSyncPostsProcedure, "hardSync"},
+}
+
+// registerConnect mounts the Connect service on the router, behind the global middlewares like the REST routes.
+// Procedures mirroring a GET operation also answer Connect GET requests so they can be cached at the CDN
+func (bc *BlogController) registerConnect(router *gin.Engine) {
+	_, handler := blogv1connect.NewBlogServiceHandler(
+		&BlogService{bc: bc},
+		connect.WithInterceptors(connectInterceptor()),
+	)
+	handler = http.StripPrefix(connectPrefix, handler)
+	routes := bc.Routes()
+	for _, procedure := range connectProcedures {
+		index := slices.IndexFunc(routes, func(route Route) bool { return route.OperationID == procedure.OperationID })
+		if index < 0 {
+			panic("connect procedure " + procedure.Procedure + " mirrors unknown operation " + procedure.OperationID)
+		}
+		route := routes[index]
+		handlers := append([]gin.HandlerFunc{bc.rateLimiter.Middleware(route.RateLimitClass())}, route.Middlewares...)
+		handlers = append(handlers, gin.WrapH(handler))
+		router.POST(connectPrefix+procedure.Procedure, handlers...)
+		if route.Method == http.MethodGet {
+			router.GET(connectPrefix+procedure.Procedure, handlers...)
+		}
+	}
+}
+
+// connectInterceptor names the request span after the procedure and maps domain errors to Connect errors,
+// field errors are sent as a google.rpc.BadRequest detail
+func connectInterceptor() connect.UnaryInterceptorFunc {
+	return func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+			procedure := request.Spec().Procedure
+			service, method, _ := strings.Cut(strings.TrimPrefix(procedure, "/"), "/")
+			span := trace.SpanFromContext(ctx)
+			span.SetName(procedure)
+			span.SetAttributes(semconv.RPCSystemKey.String("connect_rpc"), semconv.RPCService(service), semconv.RPCMethod(method))
+			response, err := next(ctx, request)
+			if err == nil {
+				return response, nil
+			}
+			connectError := newConnectError(err)
+			if connectError.Code() == connect.CodeInternal || connectError.Code() == connect.CodeUnavailable {
+				span.SetStatus(codes.Error, connectError.Message())
+				slog.ErrorContext(ctx, "Request failed", "Procedure", procedure, "Error", err)
+			} else {
+				slog.InfoContext(ctx, "Request rejected", "Procedure", procedure, "Code", connectError.Code(), "Error", err)
+			}
+			return nil, connectError
+		}
+	}
+}
+
+// newConnectError maps an error returned by the service the way NewRestError does for REST handlers
+func newConnectError(err error) *connect.Error {
+	var connectError *connect.Error
+	if errors.As(err, &connectError) {
+		return connectError
+	}
+	problem := NewRestError(err)
+	code := connect.CodeInternal
+	switch problem.Status {
+	case http.StatusBadRequest:
+		code = connect.CodeInvalidArgument
+	case http.StatusUnauthorized:
+		code = connect.CodeUnauthenticated
+	case http.StatusNotFound:
+		code = connect.CodeNotFound
+	case http.StatusConflict:
+		code = connect.CodeAborted
+	case http.StatusTooManyRequests:
+		code = connect.CodeResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		code = connect.CodeUnavailable
+	}
+	connectError = connect.NewError(code, errors.New(problem.Detail))
+	if len(problem.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, field := range problem.Errors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field.Field,
+				Description: field.Message,
+			})
+		}
+		if detail, err := connect.NewErrorDetail(badRequest); err == nil {
+			connectError.AddDetail(detail)
+		}
+	}
+	return connectError
+}
+
+// BlogService implements the Connect service on top of the controller, requests go through
+// the binding rules and validation of their REST counterparts
+type BlogService struct {
+	bc *BlogController
+}
+
+func (s *BlogService) ListPosts(ctx context.Context, request *connect.Request[blogv1.ListPostsRequest]) (*connect.Response[blogv1.ListPostsResponse], error) {
+	query := newListPostsQuery(request.Msg)
+	if err := binding.Validator.ValidateStruct(&query); err != nil {
+		bindingError := NewBindingError(err)
+		bindingError.Fields = append(bindingError.Fields, query.Validate(s.bc.limits.Max(apiPrefix+"/posts"))...)
+		return nil, bindingError
+	}
+	if fieldErrors := query.Validate(s.bc.limits.Max(apiPrefix + "/posts")); len(fieldErrors) > 0 {
+		return nil, NewValidationError(fieldErrors)
+	}
+	result, err := s.bc.listPosts(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	response := &blogv1.ListPostsResponse{NextCursor: result.NextCursor, PrevCursor: result.PrevCursor}
+	for i := range result.Items {
+		response.Posts = append(response.Posts, newPostMessage(&result.Items[i]))
+	}
+	if result.Total != nil {
+		total := int32(*result.Total)
+		response.Total = &total
+	}
+	return connect.NewResponse(response), nil
+}
+
+func (s *BlogService) GetPost(ctx context.Context, request *connect.Request[blogv1.GetPostRequest]) (*connect.Response[blogv1.GetPostResponse], error) {
+	post, err := s.bc.repository.GetPost(ctx, request.Msg.GetSlug())
+	if err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&blogv1.GetPostResponse{Post: newPostMessage(post)}), nil
+}
+
+func (s *BlogService) ListTags(ctx context.Context, _ *connect.Request[blogv1.ListTagsRequest]) (*connect.Response[blogv1.ListTagsResponse], error) {
+	tags, err := s.bc.repository.GetTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	response := &blogv1.ListTagsResponse{}
+	for _, tag := range *tags {
+		response.Tags = append(response.Tags, &blogv1.Tag{Name: tag.Tag, Count: int32(tag.Count)})
+	}
+	return connect.NewResponse(response), nil
+}
+
+func (s *BlogService) UpsertPost(ctx context.Context, request *connect.Request[blogv1.UpsertPostRequest]) (*connect.Response[blogv1.UpsertPostResponse], error) {
+	post := newPostFromMessage(request.Msg.GetPost())
+	if err := binding.Validator.ValidateStruct(&post); err != nil {
+		return nil, NewBindingError(err)
+	}
+	if err := s.bc.upsertPost(ctx, &post, ""); err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&blogv1.UpsertPostResponse{}), nil
+}
+
+func (s *BlogService) DeletePost(ctx context.Context, request *connect.Request[blogv1.DeletePostRequest]) (*connect.Response[blogv1.DeletePostResponse], error) {
+	if err := s.bc.deletePost(ctx, request.Msg.GetSlug(), "slug"); err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&blogv1.DeletePostResponse{}), nil
+}
+
+func (s *BlogService) SyncPosts(ctx context.Context, request *connect.Request[blogv1.SyncPostsRequest]) (*connect.Response[blogv1.SyncPostsResponse], error) {
+	body := HardSyncRequest{}
+	for _, message := range request.Msg.GetPosts() {
+		body.Posts = append(body.Posts, newPostFromMessage(message))
+	}
+	if err := binding.Validator.ValidateStruct(&body); err != nil {
+		return nil, NewBindingError(err)
+	}
+	if err := s.bc.syncPosts(ctx, body.Posts); err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&blogv1.SyncPostsResponse{}), nil
+}
+
+// newListPostsQuery maps a request to the query of the REST listing, applying the same defaults
+func newListPostsQuery(request *blogv1.ListPostsRequest) ListPostsQuery {
+	query := ListPostsQuery{
+		Limit:  int(request.GetLimit()),
+		Cursor: request.GetCursor(),
+		Tag:    request.GetTag(),
+		From:   request.GetFrom(),
+		To:     request.GetTo(),
+		Count:  request.GetIncludeTotal(),
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultPageSize
+	}
+	switch request.GetSort() {
+	case blogv1.SortOrder_SORT_ORDER_UNSPECIFIED, blogv1.SortOrder_SORT_ORDER_DESC:
+		query.Sort = "desc"
+	case blogv1.SortOrder_SORT_ORDER_ASC:
+		query.Sort = "asc"
+	default:
+		// unknown enum values are kept so the oneof rule rejects them
+		query.Sort = request.GetSort().String()
+	}
+	return query
+}
+
+func newPostMessage(post *Post) *blogv1.Post {
+	return &blogv1.Post{
+		Slug:        post.Slug,
+		Title:       post.Title,
+		Description: post.Description,
+		Tags:        post.Tags,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+		Series:      post.Series,
+		SeriesOrder: int32(post.SeriesOrder),
+		Body:        post.Body,
+		WordCount:   int32(post.WordCount),
+		ReadingTime: int32(post.ReadingTime),
+		Toc:         newTocMessages(post.Toc),
+	}
+}
+
+func newTocMessages(items []TocItem) []*blogv1.TocItem {
+	var messages []*blogv1.TocItem
+	for _, item := range items {
+		messages = append(messages, &blogv1.TocItem{Title: item.Title, Url: item.URL, Items: newTocMessages(item.Items)})
+	}
+	return messages
+}
+
+// newPostFromMessage maps a post message to a Post, word count, reading time and toc are derived by the repository
+func newPostFromMessage(message *blogv1.Post) Post {
+	return Post{
+		Slug:        message.GetSlug(),
+		Title:       message.GetTitle(),
+		Description: message.GetDescription(),
+		Tags:        message.GetTags(),
+		CreatedAt:   message.GetCreatedAt(),
+		Series:      message.GetSeries(),
+		SeriesOrder: int(message.GetSeriesOrder()),
+		Body:        message.GetBody(),
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	blogv1 "cloudificando/gen/cloudificando/blog/v1"
+	"cloudificando/gen/cloudificando/blog/v1/blogv1connect"
+
+	"connectrpc.com/connect"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+func TestConnectSharesValidation(t *testing.T) {
+	RegisterBindingFieldNames()
+	server := httptest.NewServer(NewRouter(newTestController()))
+	defer server.Close()
+	client := blogv1connect.NewBlogServiceClient(server.Client(), server.URL+connectPrefix, connect.WithHTTPGet())
+
+	_, err := client.ListPosts(context.Background(), connect.NewRequest(&blogv1.ListPostsRequest{Limit: 1000, From: "2026-02-30"}))
+	assertFieldViolations(t, err, "limit", "from")
+
+	_, err = client.UpsertPost(context.Background(), connect.NewRequest(&blogv1.UpsertPostRequest{
+		Post: &blogv1.Post{Slug: "Not A Slug", Title: "Title", Description: "Description", Tags: []string{"go"}, CreatedAt: "2026-01-01"},
+	}))
+	assertFieldViolations(t, err, "slug")
+
+	_, err = client.SyncPosts(context.Background(), connect.NewRequest(&blogv1.SyncPostsRequest{}))
+	assertFieldViolations(t, err, "posts")
+}
+
+func assertFieldViolations(t *testing.T, err error, fields ...string) {
+	t.Helper()
+	var connectError *connect.Error
+	if !errors.As(err, &connectError) || connectError.Code() != connect.CodeInvalidArgument {
+		t.Fatalf("expected an invalid argument error, got %v", err)
+	}
+	violations := map[string]bool{}
+	for _, detail := range connectError.Details() {
+		value, err := detail.Value()
+		if badRequest, ok := value.(*errdetails.BadRequest); ok && err == nil {
+			for _, violation := range badRequest.GetFieldViolations() {
+				violations[violation.GetField()] = true
+			}
+		}
+	}
+	for _, field := range fields {
+		if !violations[field] {
+			t.Errorf("expected a violation of %s, got %v", field, violations)
+		}
+	}
+}
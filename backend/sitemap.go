@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const sitemapContentType = "application/xml"
+
+// sitemapPageSize is the number of URLs per sitemap, past it sitemap.xml becomes an index of pages
+// as the sitemaps protocol caps sitemaps at 50,000 URLs
+var sitemapPageSize = 50000
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// sitemapURL is an entry of a urlset or of a sitemap index
+type sitemapURL struct {
+	Loc          string    `xml:"loc"`
+	LastMod      string    `xml:"lastmod,omitempty"`
+	lastModified time.Time // LastMod parsed, to compute the lastmod of pages
+}
+
+// SitemapHandler serves the sitemap of the site, or an index of its pages when there are too many URLs for one sitemap
+func (bc *BlogController) SitemapHandler(c *gin.Context) {
+	urls, err := bc.sitemapURLs(c.Request.Context())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	pages := sitemapPages(urls)
+	if len(pages) == 1 {
+		writeSitemap(c, sitemapURLSet{URLs: urls}, latestModified(urls))
+		return
+	}
+	index := sitemapIndex{}
+	for i, page := range pages {
+		index.Sitemaps = append(index.Sitemaps, newSitemapURL(
+			fmt.Sprintf("%s%s/sitemaps/%d.xml", requestOrigin(c), legacyPrefix, i+1),
+			latestModified(page),
+		))
+	}
+	writeSitemap(c, index, latestModified(urls))
+}
+
+// SitemapPageHandler serves a page of the sitemap index, pages are numbered from 1 e.g. /blog/sitemaps/2.xml
+func (bc *BlogController) SitemapPageHandler(c *gin.Context) {
+	number, err := strconv.Atoi(strings.TrimSuffix(c.Param("page"), ".xml"))
+	if err != nil || !strings.HasSuffix(c.Param("page"), ".xml") {
+		abortWithError(c, &NotFoundError{Resource: "sitemap", Key: c.Param("page")})
+		return
+	}
+	urls, err := bc.sitemapURLs(c.Request.Context())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	pages := sitemapPages(urls)
+	if number < 1 || number > len(pages) {
+		abortWithError(c, &NotFoundError{Resource: "sitemap", Key: c.Param("page")})
+		return
+	}
+	page := pages[number-1]
+	writeSitemap(c, sitemapURLSet{URLs: page}, latestModified(page))
+}
+
+// sitemapURLs lists the home page, the posts listing, tag pages and posts. The lastmod of a post is its last update,
+// the lastmod of a listing the last update of the posts it lists
+func (bc *BlogController) sitemapURLs(ctx context.Context) ([]sitemapURL, error) {
+	posts, err := bc.repository.partitionPosts(ctx, "", false)
+	if err != nil {
+		return nil, err
+	}
+	// tagged as a listing only, a key per post would make the header as large as the sitemap
+	addSurrogateKeys(ctx, listPostsKey)
+	site := siteURL()
+	var latest time.Time
+	tags := map[string]time.Time{}
+	postURLs := make([]sitemapURL, 0, len(posts))
+	// newest first, the partition is ordered by creation date
+	for i := len(posts) - 1; i >= 0; i-- {
+		post := &posts[i]
+		modified := postLastModified(post)
+		latest = later(latest, modified)
+		for _, tag := range post.Tags {
+			tags[tag] = later(tags[tag], modified)
+		}
+		postURLs = append(postURLs, newSitemapURL(postURL(post), modified))
+	}
+	urls := []sitemapURL{newSitemapURL(site+"/", latest), newSitemapURL(site+"/posts", latest)}
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	slices.Sort(names)
+	for _, tag := range names {
+		urls = append(urls, newSitemapURL(site+"/posts?tag="+url.QueryEscape(tag), tags[tag]))
+	}
+	return append(urls, postURLs...), nil
+}
+
+// postLastModified is when the post was last updated, posts written before updated_at was tracked fall back to created_at
+func postLastModified(post *Post) time.Time {
+	if updated, err := time.Parse(time.RFC3339, post.UpdatedAt); err == nil {
+		return updated
+	}
+	return postTime(post)
+}
+
+func newSitemapURL(loc string, lastModified time.Time) sitemapURL {
+	entry := sitemapURL{Loc: loc, lastModified: lastModified}
+	if !lastModified.IsZero() {
+		entry.LastMod = lastModified.UTC().Format(time.RFC3339)
+	}
+	return entry
+}
+
+func sitemapPages(urls []sitemapURL) [][]sitemapURL {
+	var pages [][]sitemapURL
+	for start := 0; start < len(urls); start += sitemapPageSize {
+		pages = append(pages, urls[start:min(start+sitemapPageSize, len(urls))])
+	}
+	return pages
+}
+
+func latestModified(urls []sitemapURL) time.Time {
+	var latest time.Time
+	for _, entry := range urls {
+		latest = later(latest, entry.lastModified)
+	}
+	return latest
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+func writeSitemap(c *gin.Context, document any, lastModified time.Time) {
+	body, err := marshalXML(document)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	writeDocument(c, sitemapContentType, body, lastModified)
+}
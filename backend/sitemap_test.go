@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitemapPages(t *testing.T) {
+	defer func(size int) { sitemapPageSize = size }(sitemapPageSize)
+	sitemapPageSize = 2
+	day := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	urls := []sitemapURL{
+		newSitemapURL("https://example.com/", day.AddDate(0, 0, 2)),
+		newSitemapURL("https://example.com/posts", day),
+		newSitemapURL("https://example.com/posts/a", day.AddDate(0, 0, 5)),
+	}
+	pages := sitemapPages(urls)
+	if len(pages) != 2 || len(pages[1]) != 1 {
+		t.Fatalf("expected pages of 2 and 1 URLs, got %v", pages)
+	}
+	if got := latestModified(pages[0]); !got.Equal(day.AddDate(0, 0, 2)) {
+		t.Errorf("unexpected lastmod of the first page %s", got)
+	}
+	body, err := marshalXML(sitemapURLSet{URLs: pages[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "<loc>https://example.com/posts/a</loc>\n    <lastmod>2026-03-06T00:00:00Z</lastmod>") {
+		t.Errorf("unexpected sitemap %s", body)
+	}
+}
+
+func TestPostLastModified(t *testing.T) {
+	post := Post{CreatedAt: "2026-01-15"}
+	if got := postLastModified(&post); !got.Equal(time.Date(2026, time.January, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected created_at as a fallback, got %s", got)
+	}
+	post.UpdatedAt = "2026-02-01T08:00:00Z"
+	if got := postLastModified(&post); !got.Equal(time.Date(2026, time.February, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected updated_at, got %s", got)
+	}
+}
+
+func TestPostChanged(t *testing.T) {
+	existing := Post{Title: "Title", Tags: []string{"go"}, CreatedAt: "2026-01-15", BodyHash: "abc"}
+	if postChanged(existing, existing, "abc") {
+		t.Error("rewriting the same post shouldn't count as a change")
+	}
+	updated := existing
+	updated.Tags = []string{"go", "aws"}
+	if !postChanged(existing, updated, "abc") || !postChanged(existing, existing, "def") {
+		t.Error("tag and body changes should count as changes")
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoType "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// listPostsKey tags responses that change whenever any post is written: listings, feeds, sitemaps,
+	// neighbours and related posts
+	listPostsKey = "list:posts"
+	listTagsKey  = "list:tags"
+	// maxInvalidationPaths caps the paths of a single invalidation, past it the whole API is invalidated
+	// as CloudFront limits the paths in progress
+	maxInvalidationPaths = 1000
+	// surrogateKeyRecordWindow is how long an instance skips recording a path it already recorded,
+	// records outlive the CDN TTL by as much so responses sent meanwhile stay covered
+	surrogateKeyRecordWindow = time.Hour
+	maxRecordedPaths         = 10000
+)
+
+// connectGetQuery are the query parameters of Connect GET requests
+var connectGetQuery = []string{"connect", "encoding", "message", "base64", "compression"}
+
+func postKey(slug string) string {
+	return "post:" + url.PathEscape(slug)
+}
+
+func tagKey(tag string) string {
+	return "tag:" + url.PathEscape(tag)
+}
+
+func seriesKey(series string) string {
+	return "series:" + url.PathEscape(series)
+}
+
+// postKeys are the keys of the posts a response contains
+func postKeys(posts []Post) []string {
+	keys := make([]string, 0, len(posts))
+	for _, post := range posts {
+		keys = append(keys, postKey(post.Slug))
+	}
+	return keys
+}
+
+// surrogateKeys collects the keys of the data a response is built from
+type surrogateKeys struct {
+	mu          sync.Mutex
+	keys        []string
+	uncacheable bool
+}
+
+type surrogateKeysContextKey struct{}
+
+// addSurrogateKeys tags the response of the request ctx belongs to, reads outside of a request are ignored
+func addSurrogateKeys(ctx context.Context, keys ...string) {
+	collector, ok := ctx.Value(surrogateKeysContextKey{}).(*surrogateKeys)
+	if !ok {
+		return
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for _, key := range keys {
+		if !slices.Contains(collector.keys, key) {
+			collector.keys = append(collector.keys, key)
+		}
+	}
+}
+
+// markUncacheable keeps the response of the request ctx belongs to out of the CDN and the index, for reads
+// of parameters taking unbounded values e.g. date ranges, reads outside of a request are ignored
+func markUncacheable(ctx context.Context) {
+	collector, ok := ctx.Value(surrogateKeysContextKey{}).(*surrogateKeys)
+	if !ok {
+		return
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.uncacheable = true
+}
+
+func (sk *surrogateKeys) isUncacheable() bool {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	return sk.uncacheable
+}
+
+func (sk *surrogateKeys) list() []string {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	return slices.Clone(sk.keys)
+}
+
+// SurrogateKeyIndex maps surrogate keys to the paths of the cached responses tagged with them,
+// so a write can purge exactly the responses containing what it changed
+type SurrogateKeyIndex struct {
+	repository *BlogRepository
+	mu         sync.Mutex
+	recorded   map[string]time.Time // path and keys -> when this instance recorded them
+	now        func() time.Time
+}
+
+func NewSurrogateKeyIndex(repository *BlogRepository) *SurrogateKeyIndex {
+	return &SurrogateKeyIndex{repository: repository, recorded: map[string]time.Time{}, now: time.Now}
+}
+
+// Middleware collects the keys added by the reads of GET requests, sends them in the Surrogate-Key header
+// and records the path under each of them before the response is written, for as long as the CDN may keep it.
+// Only the query parameters a route binds are allowed in recorded paths, responses to other queries, marked
+// uncacheable by their reads or whose path couldn't be recorded are sent uncacheable as no write would purge them.
+// It must run after the cache policy middleware
+func (ski *SurrogateKeyIndex) Middleware(routes []Route, policies *CachePolicies) gin.HandlerFunc {
+	queries := cacheableQueries(routes)
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+		collector := &surrogateKeys{}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), surrogateKeysContextKey{}, collector))
+		c.Writer = &surrogateKeyWriter{
+			ResponseWriter: c.Writer, index: ski, collector: collector, request: c.Request,
+			query: queries[c.FullPath()], ttl: policies.For(c.Request.Method, c.FullPath()).CdnTTL(),
+		}
+		c.Next()
+	}
+}
+
+// cacheableQueries maps the path of each GET route, and of the Connect procedure mirroring it, to the query
+// parameters it binds
+func cacheableQueries(routes []Route) map[string][]string {
+	queries := map[string][]string{}
+	for _, route := range routes {
+		if route.Method != http.MethodGet {
+			continue
+		}
+		queries[route.Path] = queryNames(route.Query)
+		for _, procedure := range connectProcedures {
+			if procedure.OperationID == route.OperationID {
+				queries[connectPrefix+procedure.Procedure] = connectGetQuery
+			}
+		}
+	}
+	return queries
+}
+
+// Record stores path under each key until the CDN forgets it. Records are kept by invalidations and expire
+// through the table TTL instead, so an instance may skip recording a path it recorded within the record window
+// without missing an invalidation made by another one
+func (ski *SurrogateKeyIndex) Record(ctx context.Context, keys []string, path string, ttl time.Duration) error {
+	entry := path + " " + strings.Join(keys, " ")
+	now := ski.now()
+	ski.mu.Lock()
+	recordedAt, ok := ski.recorded[entry]
+	ski.mu.Unlock()
+	if ok && now.Sub(recordedAt) < surrogateKeyRecordWindow {
+		return nil
+	}
+	if err := ski.repository.PutSurrogateKeyPaths(ctx, keys, path, now.Add(ttl+surrogateKeyRecordWindow)); err != nil {
+		return err
+	}
+	ski.mu.Lock()
+	defer ski.mu.Unlock()
+	if len(ski.recorded) >= maxRecordedPaths {
+		for entry, recordedAt := range ski.recorded {
+			if now.Sub(recordedAt) >= surrogateKeyRecordWindow {
+				delete(ski.recorded, entry)
+			}
+		}
+	}
+	if len(ski.recorded) < maxRecordedPaths {
+		ski.recorded[entry] = now
+	}
+	return nil
+}
+
+// Invalidate purges the cached responses tagged with any of the keys and returns the ID of the invalidation,
+// empty when nothing was cached
+func (ski *SurrogateKeyIndex) Invalidate(ctx context.Context, keys ...string) (string, error) {
+	entries, err := ski.repository.GetSurrogateKeyPaths(ctx, keys)
+	if err != nil || len(entries) == 0 {
+		return "", err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !slices.Contains(paths, entry.Path) {
+			paths = append(paths, entry.Path)
+		}
+	}
+	if len(paths) > maxInvalidationPaths {
+		paths = []string{legacyPrefix + "/*"}
+	}
+	return ski.repository.InvalidateCdnCache(ctx, paths...)
+}
+
+// surrogateKeyWriter tags the response once its status is known, only successful responses are cached
+type surrogateKeyWriter struct {
+	gin.ResponseWriter
+	index     *SurrogateKeyIndex
+	collector *surrogateKeys
+	request   *http.Request
+	query     []string      // query parameters the route binds
+	ttl       time.Duration // how long the CDN may keep the response, zero when it isn't cached
+	tagged    bool
+}
+
+func (w *surrogateKeyWriter) WriteHeader(code int) {
+	w.tag(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *surrogateKeyWriter) WriteHeaderNow() {
+	w.tag(w.Status())
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *surrogateKeyWriter) Write(data []byte) (int, error) {
+	w.tag(w.Status())
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *surrogateKeyWriter) WriteString(s string) (int, error) {
+	w.tag(w.Status())
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *surrogateKeyWriter) tag(status int) {
+	if w.tagged || w.Written() || (status != http.StatusOK && status != http.StatusNotModified) {
+		return
+	}
+	w.tagged = true
+	keys := w.collector.list()
+	if len(keys) == 0 {
+		return
+	}
+	w.Header().Set("Surrogate-Key", strings.Join(keys, " "))
+	// handlers send no-store on responses the CDN must not keep, so there's nothing to purge later
+	if w.ttl <= 0 || strings.Contains(w.Header().Get("Cache-Control"), "no-store") {
+		return
+	}
+	ctx := w.request.Context()
+	query, err := url.ParseQuery(w.request.URL.RawQuery)
+	if err != nil || !bindsQuery(w.query, query) || w.collector.isUncacheable() {
+		// recording arbitrary query strings would let anyone grow the index without bound
+		w.Header().Set("Cache-Control", "no-store")
+		return
+	}
+	if err := w.index.Record(ctx, recordedKeys(keys), w.request.URL.RequestURI(), w.ttl); err != nil {
+		slog.ErrorContext(ctx, "Failed to record surrogate keys, the response won't be cached", "Error", err)
+		w.Header().Set("Cache-Control", "no-store")
+	}
+}
+
+// bindsQuery tells whether every parameter of query is one of names, given once
+func bindsQuery(names []string, query url.Values) bool {
+	for name, values := range query {
+		if !slices.Contains(names, name) || len(values) > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// recordedKeys are the keys a path is recorded under. Every post write purges listPostsKey and listTagsKey,
+// so a response tagged with either is only recorded under them, a listing costs one item instead of one per post
+func recordedKeys(keys []string) []string {
+	var coarse []string
+	for _, key := range keys {
+		if key == listPostsKey || key == listTagsKey {
+			coarse = append(coarse, key)
+		}
+	}
+	if len(coarse) > 0 {
+		return coarse
+	}
+	return keys
+}
+
+// invalidatePost purges the cached responses a write to a post changes, versions are the post as written
+// and as it was so the tag listings and series it joins or leaves are purged
+func (bc *BlogController) invalidatePost(ctx context.Context, slug string, versions ...*Post) {
+	keys := []string{postKey(slug), listPostsKey, listTagsKey}
+	add := func(key string) {
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	for _, version := range versions {
+		if version == nil {
+			continue
+		}
+		for _, tag := range version.Tags {
+			add(tagKey(tag))
+		}
+		if version.Series != "" {
+			add(seriesKey(version.Series))
+		}
+	}
+	invalidationID, err := bc.surrogateKeys.Invalidate(ctx, keys...)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to invalidate the CDN cache", "Slug", slug, "Error", err)
+		return
+	}
+	bc.warmer.AfterInvalidation(ctx, invalidationID, slug)
+}
+
+// invalidateAll purges every cached response of the API, after writes touching every post e.g. hard syncs
+func (bc *BlogController) invalidateAll(ctx context.Context, slugs ...string) {
+	invalidationID, err := bc.repository.InvalidateCdnCache(ctx, legacyPrefix+"/*")
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to invalidate the CDN cache", "Error", err)
+		return
+	}
+	bc.warmer.AfterInvalidation(ctx, invalidationID, slugs...)
+}
+
+func surrogateKeyPartitionKey(key string) string {
+	return fmt.Sprintf("SURROGATE_KEY#%s", key)
+}
+
+func surrogateKeyPathSortKey(path string) string {
+	return fmt.Sprintf("PATH#%s", path)
+}
+
+// PutSurrogateKeyPaths stores path under each key until expires
+func (r *BlogRepository) PutSurrogateKeyPaths(ctx context.Context, keys []string, path string, expires time.Time) error {
+	var requests []dynamoType.WriteRequest
+	for _, key := range keys {
+		requests = append(requests, dynamoType.WriteRequest{PutRequest: &dynamoType.PutRequest{
+			Item: map[string]dynamoType.AttributeValue{
+				"PK":         &dynamoType.AttributeValueMemberS{Value: surrogateKeyPartitionKey(key)},
+				"SK":         &dynamoType.AttributeValueMemberS{Value: surrogateKeyPathSortKey(path)},
+				"path":       &dynamoType.AttributeValueMemberS{Value: path},
+				"Type":       &dynamoType.AttributeValueMemberS{Value: "SURROGATE_KEY"},
+				"expires_at": &dynamoType.AttributeValueMemberN{Value: strconv.FormatInt(expires.Unix(), 10)},
+			},
+		}})
+	}
+	return r.batchWrite(ctx, requests)
+}
+
+// SurrogateKeyPath is a path stored under a surrogate key
+type SurrogateKeyPath struct {
+	Key  string
+	Path string
+}
+
+// GetSurrogateKeyPaths returns the unexpired paths stored under any of the keys, the table TTL deletes expired
+// items lazily
+func (r *BlogRepository) GetSurrogateKeyPaths(ctx context.Context, keys []string) ([]SurrogateKeyPath, error) {
+	var entries []SurrogateKeyPath
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	for _, key := range keys {
+		paginator := dynamodb.NewQueryPaginator(r.Db, &dynamodb.QueryInput{
+			TableName:              aws.String(r.tableName),
+			KeyConditionExpression: aws.String("PK = :pk"),
+			FilterExpression:       aws.String("attribute_not_exists(expires_at) OR expires_at > :now"),
+			ExpressionAttributeValues: map[string]dynamoType.AttributeValue{
+				":pk":  &dynamoType.AttributeValueMemberS{Value: surrogateKeyPartitionKey(key)},
+				":now": &dynamoType.AttributeValueMemberN{Value: now},
+			},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range page.Items {
+				if path, ok := item["path"].(*dynamoType.AttributeValueMemberS); ok {
+					entries = append(entries, SurrogateKeyPath{Key: key, Path: path.Value})
+				}
+			}
+		}
+	}
+	return entries, nil
+}
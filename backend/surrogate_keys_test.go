@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoType "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// newFakeDynamoRepository returns a repository whose DynamoDB calls are answered by handler
+func newFakeDynamoRepository(t *testing.T, handler http.HandlerFunc) *BlogRepository {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	db := dynamodb.New(dynamodb.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  aws.AnonymousCredentials{},
+	})
+	return &BlogRepository{Db: db, tableName: "BlogTable"}
+}
+
+func TestSurrogateKeysAreRecorded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var written []string
+	failing := false
+	repository := newFakeDynamoRepository(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var request struct {
+			RequestItems map[string][]struct {
+				PutRequest struct {
+					Item map[string]map[string]string
+				}
+			}
+		}
+		_ = json.Unmarshal(body, &request)
+		if failing {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ValidationException","message":"boom"}`))
+			return
+		}
+		for _, put := range request.RequestItems["BlogTable"] {
+			if put.PutRequest.Item["expires_at"]["N"] == "" {
+				t.Errorf("expected %s to expire", put.PutRequest.Item["SK"]["S"])
+			}
+			written = append(written, put.PutRequest.Item["PK"]["S"]+" "+put.PutRequest.Item["SK"]["S"])
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		_, _ = w.Write([]byte(`{"UnprocessedItems":{}}`))
+	})
+
+	routes := []Route{{Method: "GET", Path: "/blog/v1/posts", Query: ListPostsQuery{}}, {Method: "GET", Path: "/blog/v1/series/:series"}}
+	router := gin.New()
+	policies := NewCachePolicies(routes)
+	router.Use(policies.Middleware(), NewSurrogateKeyIndex(repository).Middleware(routes, policies))
+	router.GET("/blog/v1/posts", func(c *gin.Context) {
+		addSurrogateKeys(c.Request.Context(), listPostsKey, postKey("a"), listPostsKey)
+		if c.Query("from") != "" {
+			markUncacheable(c.Request.Context())
+		}
+		c.JSON(200, ListPosts{})
+	})
+	router.GET("/blog/v1/series/:series", func(c *gin.Context) {
+		addSurrogateKeys(c.Request.Context(), seriesKey(c.Param("series")), postKey("a"))
+		c.JSON(200, SeriesPosts{})
+	})
+	send := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", target, nil))
+		return recorder
+	}
+
+	recorder := send("/blog/v1/posts?tag=go")
+	if got := recorder.Header().Get("Surrogate-Key"); got != "list:posts post:a" {
+		t.Errorf("unexpected Surrogate-Key %q", got)
+	}
+	// every post write purges list:posts, so listings aren't recorded under the keys of their posts
+	if len(written) != 1 || written[0] != "SURROGATE_KEY#list:posts PATH#/blog/v1/posts?tag=go" {
+		t.Errorf("unexpected recorded paths %v", written)
+	}
+	if recorder.Header().Get("Cache-Control") == "no-store" {
+		t.Error("recorded responses should stay cacheable")
+	}
+	send("/blog/v1/posts?tag=go")
+	if len(written) != 1 {
+		t.Errorf("paths recorded by the instance shouldn't be recorded again, got %v", written)
+	}
+
+	for _, target := range []string{"/blog/v1/posts?tag=go&x=random", "/blog/v1/posts?tag=go&tag=go", "/blog/v1/posts?from=2024-01-01"} {
+		recorder = send(target)
+		if len(written) != 1 || recorder.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s shouldn't be recorded nor cached, got %v with %q", target, written, recorder.Header().Get("Cache-Control"))
+		}
+	}
+
+	send("/blog/v1/series/go")
+	if len(written) != 3 || written[1] != "SURROGATE_KEY#series:go PATH#/blog/v1/series/go" || written[2] != "SURROGATE_KEY#post:a PATH#/blog/v1/series/go" {
+		t.Errorf("expected responses without a listing key to be recorded under every key, got %v", written)
+	}
+
+	failing = true
+	recorder = send("/blog/v1/posts")
+	if recorder.Code != 200 || recorder.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("responses that couldn't be recorded shouldn't be cached, got %d with %q", recorder.Code, recorder.Header().Get("Cache-Control"))
+	}
+}
+
+func TestBatchWriteRetriesUnprocessedItems(t *testing.T) {
+	attempts := 0
+	repository := newFakeDynamoRepository(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if attempts < 3 {
+			_, _ = w.Write([]byte(`{"UnprocessedItems":{"BlogTable":[{"DeleteRequest":{"Key":{"PK":{"S":"A"},"SK":{"S":"B"}}}}]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"UnprocessedItems":{}}`))
+	})
+	request := dynamoType.WriteRequest{DeleteRequest: &dynamoType.DeleteRequest{Key: map[string]dynamoType.AttributeValue{
+		"PK": &dynamoType.AttributeValueMemberS{Value: "A"}, "SK": &dynamoType.AttributeValueMemberS{Value: "B"},
+	}}}
+	if err := repository.batchWrite(context.Background(), []dynamoType.WriteRequest{request}); err != nil || attempts != 3 {
+		t.Errorf("expected the unprocessed items to be retried, got %d attempts and %v", attempts, err)
+	}
+}
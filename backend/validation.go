@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	maxSlugLength        = 100
+	maxTitleLength       = 200
+	maxDescriptionLength = 500
+	maxTags              = 10
+	maxTagLength         = 40
+	maxSeriesLength      = 100
+	maxSeriesOrder       = 999999 // fits the zero padded LSI2 sort key
+	maxBodyLength        = 2 << 20
+)
+
+var (
+	// slugPattern keeps slugs URL safe and free of the "#" and "/" separators used in keys
+	slugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	// tagPattern allows tags like "go", "ci-cd", "c++" or "node.js" after normalization
+	tagPattern = regexp.MustCompile(`^[\p{Ll}\p{N}][\p{Ll}\p{N}.+-]*$`)
+)
+
+// FieldError describes why a single field of a payload was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidatePosts validates every post of a batch, field names are prefixed with the batch field and index e.g. "posts[2].slug"
+func ValidatePosts(posts []Post, field string) []FieldError {
+	var errs []FieldError
+	for i := range posts {
+		errs = append(errs, ValidatePost(&posts[i], fmt.Sprintf("%s[%d].", field, i))...)
+	}
+	return errs
+}
+
+// ValidatePost normalizes the post in place, trimming fields and normalizing tags,
+// and returns every rule it breaks, prefix is prepended to field names e.g. "posts[2]."
+func ValidatePost(post *Post, prefix string) []FieldError {
+	var errs []FieldError
+	addError := func(field, format string, args ...any) {
+		errs = append(errs, FieldError{Field: prefix + field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	post.Slug = strings.TrimSpace(post.Slug)
+	if err := validateSlug(post.Slug); err != "" {
+		addError("slug", "%s", err)
+	}
+
+	post.Title = strings.TrimSpace(post.Title)
+	if post.Title == "" {
+		addError("title", "is required")
+	} else if utf8.RuneCountInString(post.Title) > maxTitleLength {
+		addError("title", "must be at most %d characters", maxTitleLength)
+	}
+
+	post.Description = strings.TrimSpace(post.Description)
+	if utf8.RuneCountInString(post.Description) > maxDescriptionLength {
+		addError("description", "must be at most %d characters", maxDescriptionLength)
+	}
+
+	// created_at is stored as sent, postSortKey normalizes it for ordering
+	post.CreatedAt = strings.TrimSpace(post.CreatedAt)
+	if _, ok := parsePostDate(post.CreatedAt); !ok {
+		addError("created_at", "must be an ISO-8601 date (YYYY-MM-DD) or RFC 3339 timestamp")
+	}
+
+	post.Tags = normalizeTags(post.Tags)
+	if len(post.Tags) > maxTags {
+		addError("tags", "must have at most %d tags", maxTags)
+	}
+	for i, tag := range post.Tags {
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			addError(fmt.Sprintf("tags[%d]", i), "must be at most %d characters", maxTagLength)
+		} else if !tagPattern.MatchString(tag) {
+			addError(fmt.Sprintf("tags[%d]", i), "may only contain letters, digits, '.', '+' and '-'")
+		}
+	}
+
+	post.Series = strings.TrimSpace(post.Series)
+	switch {
+	case post.Series == "" && post.SeriesOrder != 0:
+		addError("series", "is required with series_order")
+	case post.Series != "" && post.SeriesOrder < 1:
+		addError("series_order", "must be at least 1 with series")
+	case post.SeriesOrder > maxSeriesOrder:
+		addError("series_order", "must be at most %d", maxSeriesOrder)
+	case utf8.RuneCountInString(post.Series) > maxSeriesLength:
+		addError("series", "must be at most %d characters", maxSeriesLength)
+	case strings.ContainsAny(post.Series, "#/"):
+		addError("series", "must not contain '#' or '/'")
+	}
+
+	errs = append(errs, ValidateBody(prefix+"body", post.Body)...)
+	return errs
+}
+
+// ValidateBody returns the violations of a post body received outside of a post payload
+func ValidateBody(field, body string) []FieldError {
+	if len(body) > maxBodyLength {
+		return []FieldError{{Field: field, Message: fmt.Sprintf("must be at most %d bytes", maxBodyLength)}}
+	}
+	return nil
+}
+
+// ValidateSlug returns the violations of a slug received outside of a post payload
+func ValidateSlug(field, slug string) []FieldError {
+	if err := validateSlug(slug); err != "" {
+		return []FieldError{{Field: field, Message: err}}
+	}
+	return nil
+}
+
+func validateSlug(slug string) string {
+	switch {
+	case slug == "":
+		return "is required"
+	case len(slug) > maxSlugLength:
+		return fmt.Sprintf("must be at most %d characters", maxSlugLength)
+	case !slugPattern.MatchString(slug):
+		return "must be lowercase letters and digits separated by single hyphens"
+	}
+	return ""
+}
+
+// normalizeTags lowercases tags, collapses inner whitespace into hyphens and drops empty and duplicate tags,
+// publishers send [""] for posts without tags
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// RegisterBindingFieldNames makes binding errors name fields after their json or form tag,
+// so they point at what clients send instead of Go field names
+func RegisterBindingFieldNames() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, key := range []string{"json", "form"} {
+			name, _, _ := strings.Cut(field.Tag.Get(key), ",")
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return field.Name
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestValidatePostKeepsCreatedAt(t *testing.T) {
+	cases := map[string]string{
+		"2024-01-05":                 "2024-01-05",
+		" 2024-01-05T10:00:00+03:00": "2024-01-05T10:00:00+03:00",
+		"2024-01-05T07:00:00.5Z":     "2024-01-05T07:00:00.5Z",
+	}
+	for createdAt, want := range cases {
+		post := Post{Slug: "hello", Title: "Hello", CreatedAt: createdAt}
+		if errs := ValidatePost(&post, ""); len(errs) > 0 || post.CreatedAt != want {
+			t.Errorf("ValidatePost(%q) = %q %v, want %q", createdAt, post.CreatedAt, errs, want)
+		}
+	}
+	post := Post{Slug: "hello", Title: "Hello", CreatedAt: "05/01/2024"}
+	if errs := ValidatePost(&post, ""); len(errs) != 1 || errs[0].Field != "created_at" {
+		t.Errorf("expected created_at to be rejected, got %v", errs)
+	}
+}
+
+func TestPostSortKeyNormalizesCreatedAt(t *testing.T) {
+	cases := map[string]string{
+		"2024-01-05":                "CREATED_AT#2024-01-05#POST#hello",
+		"2024-01-05T23:00:00-05:00": "CREATED_AT#2024-01-06T04:00:00Z#POST#hello",
+		"2024-01-06T02:00:00+03:00": "CREATED_AT#2024-01-05T23:00:00Z#POST#hello",
+		"2024-01-05T07:00:00.5Z":    "CREATED_AT#2024-01-05T07:00:00Z#POST#hello",
+	}
+	for createdAt, want := range cases {
+		if got := postSortKey(Post{Slug: "hello", CreatedAt: createdAt}); got != want {
+			t.Errorf("postSortKey(%q) = %q, want %q", createdAt, got, want)
+		}
+	}
+}
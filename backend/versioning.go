@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// apiPrefix is the root of the current API version
+	apiPrefix = "/blog/v1"
+	// legacyPrefix is the root of the unversioned API, kept as an alias of the current version until its sunset
+	legacyPrefix = "/blog"
+)
+
+// defaultLegacyDeprecatedAt is when the unversioned API is deprecated in favor of /blog/v1 unless configured
+var defaultLegacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// APIRoutes mounts the route table at the current version root and at the legacy root,
+// legacy routes are flagged deprecated and announce their sunset. Unversioned routes are only mounted at the legacy root
+func APIRoutes(routes []Route) []Route {
+	deprecatedAt := legacyDeprecatedAt()
+	legacy := LegacyMiddleware(deprecatedAt, legacySunset(deprecatedAt))
+	var mounted []Route
+	for _, route := range routes {
+		versioned := route
+		versioned.Path = apiPrefix + route.Path
+		if route.Unversioned {
+			versioned.Path = legacyPrefix + route.Path
+		}
+		mounted = append(mounted, versioned)
+	}
+	for _, route := range routes {
+		if route.Unversioned {
+			continue
+		}
+		deprecated := route
+		deprecated.Path = legacyPrefix + route.Path
+		deprecated.OperationID = route.OperationID + "Legacy"
+		deprecated.Deprecated = true
+		deprecated.Middlewares = append([]gin.HandlerFunc{legacy}, route.Middlewares...)
+		mounted = append(mounted, deprecated)
+	}
+	return mounted
+}
+
+// unversionedRoute maps a route of the current version to its legacy path, so per route settings
+// configured with legacy paths e.g. ROUTE_MAX_LIMITS apply to both
+func unversionedRoute(route string) string {
+	if rest, ok := strings.CutPrefix(route, apiPrefix); ok {
+		return legacyPrefix + rest
+	}
+	return route
+}
+
+// legacyDeprecatedAt reads LEGACY_API_DEPRECATED_AT, a YYYY-MM-DD date, so the Deprecation header can be scheduled
+// ahead of a deploy, defaulting to defaultLegacyDeprecatedAt
+func legacyDeprecatedAt() time.Time {
+	return envDate("LEGACY_API_DEPRECATED_AT", defaultLegacyDeprecatedAt)
+}
+
+// legacySunset reads LEGACY_API_SUNSET, a YYYY-MM-DD date, defaulting to six months after the deprecation
+func legacySunset(deprecatedAt time.Time) time.Time {
+	return envDate("LEGACY_API_SUNSET", deprecatedAt.AddDate(0, 6, 0))
+}
+
+// LegacyMiddleware marks responses of legacy routes with the Deprecation (RFC 9745) and Sunset (RFC 8594) headers
+// and a link to their successor, and counts legacy calls per route.
+// Responses are cached at the CDN so the count only covers requests reaching the origin
+func LegacyMiddleware(deprecatedAt, sunset time.Time) gin.HandlerFunc {
+	requests, err := otel.Meter("cloudificando").Int64Counter(
+		"blog.api.legacy.requests",
+		metric.WithDescription("Requests served by the deprecated unversioned API"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		slog.Error("Failed to create the legacy requests counter", "Error", err)
+	}
+	deprecation := "@" + strconv.FormatInt(deprecatedAt.Unix(), 10)
+	sunsetHeader := sunset.UTC().Format(http.TimeFormat)
+	return func(c *gin.Context) {
+		successor := apiPrefix + strings.TrimPrefix(c.Request.URL.Path, legacyPrefix)
+		c.Header("Deprecation", deprecation)
+		c.Header("Sunset", sunsetHeader)
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		c.Next()
+		if requests == nil {
+			return
+		}
+		requests.Add(c.Request.Context(), 1, metric.WithAttributes(
+			attribute.String("http.route", c.FullPath()),
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.Int("http.response.status_code", c.Writer.Status()),
+		))
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLegacyRoutesAnnounceSunset(t *testing.T) {
+	router := NewRouter(newTestController())
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/blog/openapi.json", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+	if got := recorder.Header().Get("Deprecation"); got != "@1792368000" {
+		t.Errorf("unexpected Deprecation header %q", got)
+	}
+	sunset, err := http.ParseTime(recorder.Header().Get("Sunset"))
+	if err != nil || !sunset.Equal(defaultLegacyDeprecatedAt.AddDate(0, 6, 0)) {
+		t.Errorf("unexpected Sunset header %q", recorder.Header().Get("Sunset"))
+	}
+	if got := recorder.Header().Get("Link"); got != `</blog/v1/openapi.json>; rel="successor-version"` {
+		t.Errorf("unexpected Link header %q", got)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/blog/v1/openapi.json", nil))
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Deprecation") != "" {
+		t.Errorf("versioned route answered %d with Deprecation %q", recorder.Code, recorder.Header().Get("Deprecation"))
+	}
+}
+
+func TestLegacyDatesFromEnv(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	cases := map[string]struct {
+		deprecatedAt, sunset         string
+		wantDeprecatedAt, wantSunset time.Time
+	}{
+		"defaults":             {wantDeprecatedAt: date(2026, time.October, 19), wantSunset: date(2027, time.April, 19)},
+		"scheduled":            {deprecatedAt: "2027-01-01", wantDeprecatedAt: date(2027, time.January, 1), wantSunset: date(2027, time.July, 1)},
+		"explicit sunset":      {deprecatedAt: "2027-01-01", sunset: "2027-03-31", wantDeprecatedAt: date(2027, time.January, 1), wantSunset: date(2027, time.March, 31)},
+		"invalid dates":        {deprecatedAt: "soon", sunset: "31/01/2027", wantDeprecatedAt: date(2026, time.October, 19), wantSunset: date(2027, time.April, 19)},
+		"invalid sunset alone": {sunset: "later", wantDeprecatedAt: date(2026, time.October, 19), wantSunset: date(2027, time.April, 19)},
+	}
+	for name, tc := range cases {
+		t.Setenv("LEGACY_API_DEPRECATED_AT", tc.deprecatedAt)
+		t.Setenv("LEGACY_API_SUNSET", tc.sunset)
+		deprecatedAt := legacyDeprecatedAt()
+		sunset := legacySunset(deprecatedAt)
+		if !deprecatedAt.Equal(tc.wantDeprecatedAt) || !sunset.Equal(tc.wantSunset) {
+			t.Errorf("%s: expected %s and %s, got %s and %s", name, tc.wantDeprecatedAt, tc.wantSunset, deprecatedAt, sunset)
+		}
+	}
+}
+
+func TestRouteLimitsApplyToBothVersions(t *testing.T) {
+	limits := RouteLimits{"/blog/posts": 24}
+	if got := limits.Max("/blog/v1/posts"); got != 24 {
+		t.Errorf("expected the legacy limit to apply to /blog/v1/posts, got %d", got)
+	}
+	if got := limits.Max("/blog/v1/tags"); got != defaultMaxLimit {
+		t.Errorf("expected the default limit, got %d", got)
+	}
+}
@@ -8,11 +8,11 @@ const { execSync } = require('child_process');
 const topicName = process.env.GCP_TOPIC_NAME;
 const pubSubClient = new PubSub();
 
-// Extract frontmatter from an MDX file
+// Extract frontmatter and body from an MDX file
 function extractFrontmatter(filePath) {
   const content = fs.readFileSync(filePath, 'utf-8');
-  const { data: frontmatter } = matter(content);
-  return frontmatter;
+  const { data: frontmatter, content: body } = matter(content);
+  return { ...frontmatter, body };
 }
 
 // Determine event types based on git diff
@@ -32,7 +32,9 @@ function determineEventTypes(filePath) {
 
     // Check for content and metadata changes
     const diffOutput = execSync(`git diff HEAD~1 HEAD -- ${filePath}`).toString();
-    const hasMetadataChanges = ['title', 'tags', 'description', 'date'].some((field) => diffOutput.includes(field));
+    // series and its order are stored on the post item, a body only update wouldn't reach them
+    const metadataFields = ['title', 'tags', 'description', 'date', 'series', 'seriesOrder', 'series_order'];
+    const hasMetadataChanges = metadataFields.some((field) => diffOutput.includes(field));
     const hasContentChanges = diffOutput.replace(/---\n[\s\S]*?---\n/, '').trim() !== '';
 
     const events = [];
@@ -54,6 +56,9 @@ async function publishEvent(slug, frontmatter, eventType) {
     created_at: frontmatter ? frontmatter.date : "",
     description: frontmatter ? frontmatter.description : "",
     slug,
+    series: frontmatter && frontmatter.series ? frontmatter.series : "",
+    series_order: frontmatter && frontmatter.seriesOrder ? frontmatter.seriesOrder : 0,
+    body: frontmatter ? frontmatter.body : "",
   };
 
   const message = {
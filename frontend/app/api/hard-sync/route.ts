@@ -8,6 +8,9 @@ type PostData = {
   created_at: string;
   description: string | null;
   slug: string;
+  series?: string;
+  series_order?: number;
+  body: string;
 }
 
 export async function POST(req: NextRequest) {
@@ -48,36 +51,68 @@ async function performHardSync(): Promise<void> {
   for (const slug of slugs) {
     const postData = await getPostData(slug);
     if (postData) {
-      const { frontmatter } = postData;
+      const { frontmatter, rawMdx } = postData;
       posts.push({
         title: frontmatter.title,
         tags: frontmatter.tags || [],
         created_at: frontmatter.date,
         description: frontmatter.description!,
         slug: slug,
+        series: frontmatter.series,
+        series_order: frontmatter.seriesOrder,
+        body: rawMdx.replace(/^---\r?\n[\s\S]*?\r?\n---\r?\n/, ""),
       });
     }
   }
 
-  // Step 3: Make the POST request with the data
-  console.log("posts", posts)
-  const syncResponse = await fetch(process.env.NEXT_PUBLIC_BACKEND_URL + "/blog/hardsync", {
-    method: 'POST',
-    headers: {
-      'Content-Type': 'application/json',
-    },
-    body: JSON.stringify({posts}),
-  });
+  // Step 3: Make the POST requests with the data, in batches the backend Lambda accepts
+  const batches = batchPosts(posts);
+  for (const [index, batch] of batches.entries()) {
+    console.log(`Syncing batch ${index + 1}/${batches.length} of ${batch.length} posts`);
+    const syncResponse = await fetch(process.env.NEXT_PUBLIC_BACKEND_URL + "/blog/hardsync", {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({posts: batch}),
+    });
 
-  if (!syncResponse.ok) {
-    const errorDetails = await syncResponse.text();
-    console.error(syncResponse.status, errorDetails)
-    throw new Error(`Failed to sync posts: ${syncResponse.status} ${errorDetails}`);
+    if (!syncResponse.ok) {
+      const errorDetails = await syncResponse.text();
+      console.error(syncResponse.status, errorDetails)
+      throw new Error(`Failed to sync posts: ${syncResponse.status} ${errorDetails}`);
+    }
   }
 
   console.log('Posts successfully synced.');
 }
 
+// Lambda rejects request payloads over 6 MB, batches stay well below it
+const MAX_SYNC_BATCH_BYTES = 4 * 1024 * 1024;
+
+// batchPosts splits the posts into batches whose JSON stays under MAX_SYNC_BATCH_BYTES,
+// every batch is upserted on its own and the backend rebuilds counters and related posts after each
+function batchPosts(posts: PostData[]): PostData[][] {
+  const encoder = new TextEncoder();
+  const batches: PostData[][] = [];
+  let batch: PostData[] = [];
+  let batchBytes = 0;
+  for (const post of posts) {
+    const postBytes = encoder.encode(JSON.stringify(post)).length;
+    if (batch.length > 0 && batchBytes + postBytes > MAX_SYNC_BATCH_BYTES) {
+      batches.push(batch);
+      batch = [];
+      batchBytes = 0;
+    }
+    batch.push(post);
+    batchBytes += postBytes;
+  }
+  if (batch.length > 0) {
+    batches.push(batch);
+  }
+  return batches;
+}
+
 async function validateApiToken(req: NextRequest) {
   if (process.env.ENVIRONMENT === "dev") {
     return true;
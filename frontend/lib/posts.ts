@@ -13,6 +13,8 @@ export interface Frontmatter {
   published: boolean;
   tags?: string[];
   date: string;
+  series?: string;
+  seriesOrder?: number;
 }
 
 export interface PostData {
@@ -31,6 +33,8 @@ export interface FetchPostsResponse {
     created_at: string;
     description: string | null;
     slug: string;
+    word_count?: number;
+    reading_time?: number;
   }[];
   nextCursor: string | null;
 }
@@ -21,6 +21,7 @@ const dynamo = new sst.aws.Dynamo("BlogTable", {
     SK_LSI5: "string"
   },
   primaryIndex: { hashKey: "PK", rangeKey: "SK" },
+  ttl: "expires_at",
   localIndexes: {
     LSI1: {rangeKey: "SK_LSI1"},
     LSI2: {rangeKey: "SK_LSI2"},
@@ -29,6 +30,19 @@ const dynamo = new sst.aws.Dynamo("BlogTable", {
     LSI5: {rangeKey: "SK_LSI5",projection: "keys-only"},
   },
 })
+// rate limit buckets are written on every request, on-demand apart from BlogTable's provisioned capacity
+const rateLimitTable = new sst.aws.Dynamo("RateLimitTable", {
+  fields: {
+    PK: "string",
+  },
+  primaryIndex: { hashKey: "PK" },
+  ttl: "expires_at",
+})
+// delivers cache warming messages back to the backend once their invalidation had time to complete,
+// messages whose invalidation is still in progress are retried after the visibility timeout
+const cacheWarmQueue = new sst.aws.Queue("CacheWarmQueue", {
+  visibilityTimeout: "60 seconds",
+});
 const build = `GOOS=linux GOARCH=amd64 go build -o ./build/bootstrap . && cp otel-config.yaml ./build/`;
 execSync(build, {
   stdio: "inherit",
@@ -38,7 +52,8 @@ const backend = new sst.aws.Function("CloudificandoBackend", {
   runtime: "provided.al2023",
   handler: "bootstrap",
   bundle: "../backend/build",
-  url: true,
+  // CORS is handled by the backend from ALLOWED_ORIGINS, the function URL adding its own headers duplicates them
+  url: { cors: false },
   permissions: [
     {
       actions: ["ssm:GetParameter"],
@@ -51,13 +66,13 @@ const backend = new sst.aws.Function("CloudificandoBackend", {
       resources: [ "*"],
     },
     {
-      actions: ["cloudfront:CreateInvalidation"],
+      actions: ["cloudfront:CreateInvalidation", "cloudfront:GetInvalidation"],
       resources: [
         `arn:aws:cloudfront::${process.env.AWS_ACCOUNT_ID}:distribution/*`,
       ],
     }
   ],
-  link: [dynamo, pubsubTopic],
+  link: [dynamo, rateLimitTable, pubsubTopic, cacheWarmQueue],
   layers: [
     "arn:aws:lambda:us-east-1:184161586896:layer:opentelemetry-collector-amd64-0_12_0:1",
     "arn:aws:lambda:us-east-1:753240598075:layer:LambdaAdapterLayerX86:23",
@@ -75,12 +90,32 @@ const backend = new sst.aws.Function("CloudificandoBackend", {
     OTLP_CLOUDIFICANDO_TOKEN: process.env.OTLP_CLOUDIFICANDO_TOKEN!,
     OTLP_CLOUDIFICANDO_ENDPOINT: process.env.OTLP_CLOUDIFICANDO_ENDPOINT!,
     PROD_DOMAIN: process.env.BACKEND_PROD_DOMAIN!,
+    SITE_URL: "https://" + process.env.FRONTEND_PROD_DOMAIN!,
+    CACHE_WARM_BASE_URL: "https://" + process.env.BACKEND_PROD_DOMAIN!,
+    CACHE_WARM_QUEUE_URL: cacheWarmQueue.url,
+    // the Lambda adapter posts non HTTP events, the warm queue's messages, to this path
+    AWS_LWA_PASS_THROUGH_PATH: "/blog/v1/events/cache-warm",
     ALLOWED_ORIGINS: process.env.BACKEND_ALLOWED_ORIGINS!,
     AWS_SSM_CLOUDFRONT_DISTRO_ID_PATH: CLOUDFRONT_SSM_DISTRO_ID_PATH,
+    CURSOR_SECRET: process.env.BACKEND_CURSOR_SECRET!,
+    // optional per route page size caps e.g. "/blog/posts=24", unset keeps the default of every route
+    ROUTE_MAX_LIMITS: process.env.BACKEND_ROUTE_MAX_LIMITS ?? "",
+    // optional YYYY-MM-DD dates the unversioned API is flagged deprecated and sunset at, unset keeps the defaults
+    LEGACY_API_DEPRECATED_AT: process.env.BACKEND_LEGACY_API_DEPRECATED_AT ?? "",
+    LEGACY_API_SUNSET: process.env.BACKEND_LEGACY_API_SUNSET ?? "",
+    // buckets shared by every instance, an in memory bucket per instance multiplies the budget by the concurrency
+    RATE_LIMIT_STORE: "dynamodb",
+    RATE_LIMIT_TABLE_NAME: rateLimitTable.name,
+    // sent by a Cloudflare transform rule as X-Origin-Secret, CF-Connecting-IP is only trusted along it
+    RATE_LIMIT_PROXY_SECRET: process.env.BACKEND_RATE_LIMIT_PROXY_SECRET ?? "",
+    // API keys allowed to register GraphQL persisted queries, e.g. the frontend build
+    GRAPHQL_PERSIST_API_KEYS: process.env.BACKEND_GRAPHQL_PERSIST_API_KEYS ?? "",
+    PUBSUB_SERVICE_ACCOUNTS: process.env.GCP_SERVICE_ACCOUNT_EMAIL!,
     ENVIRONMENT: process.env.ENVIRONMENT!,
     GIN_MODE: "release",
   },
 });
+cacheWarmQueue.subscribe(backend.arn, { batch: { partialResponses: true } });
 const backendCloudfront = new sst.aws.Router("CloudificandoBackendCloudfront", {
   domain: {
     name: process.env.BACKEND_PROD_DOMAIN!,
@@ -90,7 +125,19 @@ const backendCloudfront = new sst.aws.Router("CloudificandoBackendCloudfront", {
     "/*": backend.url,
   },
   invalidation: true,
-  
+  transform: {
+    // the backend echoes the allowed Origin along Vary: Origin, CloudFront ignores Vary so Origin has to be
+    // in the cache key or one origin's response is served to the others
+    cachePolicy(args) {
+      args.parametersInCacheKeyAndForwardedToOrigin = {
+        cookiesConfig: { cookieBehavior: "none" },
+        headersConfig: { headerBehavior: "whitelist", headers: { items: ["Origin"] } },
+        queryStringsConfig: { queryStringBehavior: "all" },
+        enableAcceptEncodingBrotli: true,
+        enableAcceptEncodingGzip: true,
+      };
+    },
+  },
 });
 const backendSub = new gcp.pubsub.Subscription(
   "posts-updates-subscription",
@@ -7,7 +7,10 @@ const messageSchema = `
     { "name": "tags", "type": { "type": "array", "items": "string" } },
     { "name": "created_at", "type": "string" },
     { "name": "description", "type": "string" },
-    { "name": "slug", "type": "string" }
+    { "name": "slug", "type": "string" },
+    { "name": "series", "type": "string", "default": "" },
+    { "name": "series_order", "type": "int", "default": 0 },
+    { "name": "body", "type": "string", "default": "" }
   ]
 }
 `;